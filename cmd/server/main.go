@@ -5,16 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// Embute a base de fusos horários, ausente na imagem alpine, para as regras de calendário.
+	_ "time/tzdata"
 
 	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
 
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/grpc/rls"
 	httpHandlers "github.com/JeanGrijp/rate-limiter/internal/adapters/http/handlers"
 	httpMiddleware "github.com/JeanGrijp/rate-limiter/internal/adapters/http/middleware"
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/metrics"
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/blockcache"
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/breaker"
+	memorystorage "github.com/JeanGrijp/rate-limiter/internal/adapters/storage/memory"
 	redisstorage "github.com/JeanGrijp/rate-limiter/internal/adapters/storage/redis"
 	"github.com/JeanGrijp/rate-limiter/internal/config"
 	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
@@ -28,34 +37,68 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	storage, closeFn, err := initStorage(cfg.Storage)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	storage, closeFn, err := initStorage(ctx, cfg.Storage, cfg.RateLimiter.FailurePolicy)
 	if err != nil {
 		log.Fatalf("failed to init storage: %v", err)
 	}
 	defer closeFn()
 
-	limiter, err := services.NewRateLimiterService(storage, services.Config{
-		DefaultIPRule:    cfg.RateLimiter.IPRule,
-		DefaultTokenRule: cfg.RateLimiter.DefaultTokenRule,
-		TokenRules:       cloneRules(cfg.RateLimiter.TokenRules),
-	})
+	var collector *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		collector = metrics.New()
+		storage = metrics.NewStorage(storage, collector)
+	}
+
+	service, err := services.NewRateLimiterService(storage, limiterConfig(cfg.RateLimiter))
 	if err != nil {
 		log.Fatalf("failed to create limiter: %v", err)
 	}
 
+	go config.WatchRulesFile(ctx, cfg.RateLimiter, func(rl config.RateLimiterConfig) error {
+		return service.UpdateConfig(limiterConfig(rl))
+	})
+
+	var limiter ports.RateLimiter = service
+	if collector != nil {
+		limiter = metrics.NewRateLimiter(service, collector)
+	}
+
+	middlewareOpts := []httpMiddleware.Option{
+		httpMiddleware.WithTrustedProxies(cfg.Server.TrustedProxies...),
+		httpMiddleware.WithConcurrencyLimiter(service),
+	}
+	if len(cfg.Server.ClientIPHeaders) > 0 {
+		middlewareOpts = append(middlewareOpts, httpMiddleware.WithClientIPHeaders(cfg.Server.ClientIPHeaders...))
+	}
+	if cfg.Server.CostHeader != "" {
+		middlewareOpts = append(middlewareOpts, httpMiddleware.WithCostHeader(cfg.Server.CostHeader))
+	}
+	if cfg.Server.IETFRateLimitHeaders {
+		middlewareOpts = append(middlewareOpts, httpMiddleware.WithIETFHeaders())
+	}
+
 	r := chi.NewRouter()
-	r.Use(httpMiddleware.NewRateLimiterMiddleware(limiter))
-	r.Get("/test", httpHandlers.TestHandler)
+	if collector != nil {
+		r.Handle(cfg.Metrics.Path, collector.Handler())
+	}
+	if cfg.Server.AdminToken != "" {
+		r.With(httpMiddleware.NewAdminAuthMiddleware(cfg.Server.AdminToken)).
+			Mount("/admin", httpHandlers.NewAdminRouter(service))
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(httpMiddleware.NewRateLimiterMiddleware(limiter, middlewareOpts...))
+		r.Get("/test", httpHandlers.TestHandler)
+	})
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.Server.Port),
 		Handler: r,
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-
-	errCh := make(chan error, 1)
+	errCh := make(chan error, 2)
 	go func() {
 		err := srv.ListenAndServe()
 		if err != nil {
@@ -63,6 +106,21 @@ func main() {
 		}
 	}()
 
+	var grpcSrv *grpc.Server
+	if cfg.Server.GRPCPort != "" {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.Server.GRPCPort))
+		if err != nil {
+			log.Fatalf("failed to listen on gRPC port: %v", err)
+		}
+		grpcSrv = grpc.NewServer()
+		rls.NewService(limiter).Register(grpcSrv)
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
 	select {
 	case <-ctx.Done():
 		log.Println("shutdown signal received")
@@ -75,33 +133,128 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if grpcSrv != nil {
+		stopGRPC(shutdownCtx, grpcSrv)
+	}
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("graceful shutdown failed: %v", err)
 	}
 }
 
-func initStorage(cfg config.StorageConfig) (ports.Storage, func(), error) {
+// stopGRPC aguarda as chamadas em andamento e, se o prazo acabar, encerra o servidor.
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// initStorage cria o storage configurado. O Redis é envolvido por um circuit breaker e,
+// com a política de falha fallback, desvia para um storage em memória quando cai. O
+// cache de bloqueios fica por fora do breaker, para responder mesmo com o Redis fora.
+func initStorage(ctx context.Context, cfg config.StorageConfig, policy domain.FailurePolicy) (ports.Storage, func(), error) {
 	switch cfg.Type {
 	case "redis":
-		redisCfg := redisstorage.Config{
-			Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
-			Password: cfg.Redis.Password,
-			DB:       cfg.Redis.DB,
-		}
-		storage, err := redisstorage.New(redisCfg)
+		storage, err := redisstorage.New(redisConfig(cfg.Redis))
 		if err != nil {
 			return nil, nil, err
 		}
-		return storage, func() {
+
+		breakerCfg := breaker.Config{
+			FailureThreshold: cfg.Breaker.FailureThreshold,
+			OpenDuration:     cfg.Breaker.OpenDuration,
+		}
+		var fallback *memorystorage.Storage
+		if policy == domain.FailFallback {
+			fallback = newMemoryStorage(cfg.Memory)
+			breakerCfg.Fallback = fallback
+		}
+
+		var wrapped ports.Storage = breaker.New(storage, breakerCfg)
+		if cfg.BlockCache.Enabled {
+			cache := blockcache.New(wrapped, blockcache.Config{
+				MaxEntries:  cfg.BlockCache.MaxEntries,
+				Invalidator: storage,
+			})
+			go cache.Listen(ctx)
+			wrapped = cache
+		}
+
+		return wrapped, func() {
 			if err := storage.Close(); err != nil {
 				log.Printf("failed to close redis storage: %v", err)
 			}
+			if fallback != nil {
+				_ = fallback.Close()
+			}
+		}, nil
+	case "memory":
+		storage := newMemoryStorage(cfg.Memory)
+		return storage, func() {
+			_ = storage.Close()
 		}, nil
 	default:
 		return nil, nil, fmt.Errorf("unsupported storage type: %s", cfg.Type)
 	}
 }
 
+func redisConfig(cfg config.RedisConfig) redisstorage.Config {
+	redisCfg := redisstorage.Config{
+		URL:              cfg.URL,
+		Addr:             fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		MasterName:       cfg.SentinelMaster,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		TLS:              cfg.TLS,
+		TLSCAFile:        cfg.TLSCAFile,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+	}
+	switch {
+	case cfg.SentinelMaster != "":
+		redisCfg.Addrs = cfg.SentinelAddrs
+	case len(cfg.ClusterAddrs) > 0:
+		redisCfg.Cluster = true
+		redisCfg.Addrs = cfg.ClusterAddrs
+	}
+	return redisCfg
+}
+
+func newMemoryStorage(cfg config.MemoryConfig) *memorystorage.Storage {
+	return memorystorage.New(memorystorage.Config{
+		Shards:          cfg.Shards,
+		CleanupInterval: cfg.CleanupInterval,
+	})
+}
+
+func limiterConfig(cfg config.RateLimiterConfig) services.Config {
+	return services.Config{
+		DefaultIPRule:    cfg.IPRule,
+		DefaultTokenRule: cfg.DefaultTokenRule,
+		TokenRules:       cloneRules(cfg.TokenRules),
+		RouteRules:       append([]domain.RouteRule(nil), cfg.RouteRules...),
+		Combined:         cfg.Combined,
+		PairRule:         cfg.PairRule,
+		AllowList:        cfg.AllowList,
+		DenyList:         cfg.DenyList,
+		FailurePolicy:    cfg.FailurePolicy,
+		Shadow:           cfg.Shadow,
+		IPv4Prefix:       cfg.IPv4Prefix,
+		IPv6Prefix:       cfg.IPv6Prefix,
+	}
+}
+
 func cloneRules(src map[string]domain.RateLimitRule) map[string]domain.RateLimitRule {
 	if src == nil {
 		return nil
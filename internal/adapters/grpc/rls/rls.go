@@ -0,0 +1,203 @@
+// Package rls expõe o rate limiter pelo protocolo de rate limit externo do Envoy
+// (envoy.service.ratelimit.v3.RateLimitService).
+package rls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+// Chaves das entradas de descriptor reconhecidas. As demais são ignoradas.
+const (
+	KeyRemoteAddress = "remote_address"
+	KeyToken         = "token"
+	KeyMethod        = "method"
+	KeyRoute         = "route"
+)
+
+// Service implementa ShouldRateLimit avaliando cada descriptor com o RateLimiter.
+type Service struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+
+	limiter ports.RateLimiter
+}
+
+// NewService cria o serviço de rate limit do Envoy sobre o limiter informado.
+func NewService(limiter ports.RateLimiter) *Service {
+	return &Service{limiter: limiter}
+}
+
+// Register registra o serviço no servidor gRPC.
+func (s *Service) Register(server *grpc.Server) {
+	rlsv3.RegisterRateLimitServiceServer(server, s)
+}
+
+// ShouldRateLimit avalia todos os descriptors, como o serviço de referência do Envoy, e
+// nega a requisição se algum deles exceder o limite. O domínio da requisição não é
+// usado: as regras vêm da configuração do limiter, e não dos limites do descriptor.
+// O protocolo não tem como pedir ao Envoy que espere, então decisões com Delay (regras
+// com MaxDelay) são respondidas como OK imediatamente, com a vez já reservada.
+func (s *Service) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	resp := &rlsv3.RateLimitResponse{
+		OverallCode: rlsv3.RateLimitResponse_OK,
+		Statuses:    make([]*rlsv3.RateLimitResponse_DescriptorStatus, 0, len(req.GetDescriptors())),
+	}
+
+	for i, descriptor := range req.GetDescriptors() {
+		limitReq, err := requestFromDescriptor(descriptor, req.GetHitsAddend())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "descriptor %d: %v", i, err)
+		}
+
+		decision, err := s.limiter.Allow(ctx, limitReq)
+		if err != nil && !domain.IsBlockedError(err) && !domain.IsDeniedError(err) {
+			if errors.Is(err, domain.ErrUnavailable) {
+				log.Printf("rate limiter unavailable: %v", err)
+				return nil, status.Error(codes.Unavailable, "rate limiter is temporarily unavailable")
+			}
+			if errors.Is(err, domain.ErrInvalidRequest) {
+				return nil, status.Errorf(codes.InvalidArgument, "descriptor %d: %v", i, err)
+			}
+			log.Printf("rate limiter failed: %v", err)
+			return nil, status.Error(codes.Internal, "rate limiter failed")
+		}
+
+		descriptorStatus := descriptorStatus(decision)
+		if err != nil {
+			descriptorStatus.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		if descriptorStatus.Code == rlsv3.RateLimitResponse_OVER_LIMIT {
+			resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		resp.Statuses = append(resp.Statuses, descriptorStatus)
+	}
+
+	return resp, nil
+}
+
+// requestFromDescriptor traduz as entradas do descriptor para uma requisição do limiter.
+// O hits_addend do descriptor tem precedência sobre o da requisição; zero usa o custo
+// da rota ou 1.
+func requestFromDescriptor(descriptor *ratelimitv3.RateLimitDescriptor, hitsAddend uint32) (domain.RateLimitRequest, error) {
+	var req domain.RateLimitRequest
+	for _, entry := range descriptor.GetEntries() {
+		value := strings.TrimSpace(entry.GetValue())
+		switch entry.GetKey() {
+		case KeyRemoteAddress:
+			req.IP = value
+		case KeyToken:
+			req.Token = value
+		case KeyMethod:
+			req.Method = value
+		case KeyRoute:
+			req.Route = value
+		}
+	}
+	if req.IP == "" && req.Token == "" {
+		return domain.RateLimitRequest{}, fmt.Errorf("an entry %q or %q is required", KeyRemoteAddress, KeyToken)
+	}
+	if descriptor.GetIsNegativeHits() {
+		return domain.RateLimitRequest{}, fmt.Errorf("negative hits are not supported")
+	}
+
+	cost := uint64(hitsAddend)
+	if override := descriptor.GetHitsAddend(); override != nil {
+		cost = override.GetValue()
+	}
+	if cost > math.MaxInt64 {
+		return domain.RateLimitRequest{}, fmt.Errorf("hits addend %d is too large", cost)
+	}
+	req.Cost = int64(cost)
+	return req, nil
+}
+
+func descriptorStatus(decision domain.Decision) *rlsv3.RateLimitResponse_DescriptorStatus {
+	st := &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}
+	if !decision.Allowed {
+		st.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+	}
+	if decision.Limit <= 0 {
+		return st
+	}
+
+	reset := decision.ResetAfter
+	if !decision.Allowed {
+		reset = max(reset, decision.RetryAfter)
+	}
+	st.CurrentLimit = currentLimit(decision)
+	st.LimitRemaining = clampUint32(decision.Remaining)
+	st.DurationUntilReset = durationpb.New(reset)
+	return st
+}
+
+// currentLimit descreve o limite aplicado. O protocolo só expressa janelas de uma
+// unidade (segundo, minuto, ...); outras janelas vão com unidade UNKNOWN e são
+// descritas em Name, no formato do header RateLimit-Policy.
+func currentLimit(decision domain.Decision) *rlsv3.RateLimitResponse_RateLimit {
+	window := limitWindow(decision)
+	limit := &rlsv3.RateLimitResponse_RateLimit{
+		RequestsPerUnit: clampUint32(decision.Limit),
+		Unit:            unitFor(window),
+	}
+	// O mês não tem duração fixa, mas tem unidade própria no protocolo.
+	if decision.Tier.Period == domain.PeriodMonth {
+		limit.Unit = rlsv3.RateLimitResponse_RateLimit_MONTH
+	}
+	if limit.Unit == rlsv3.RateLimitResponse_RateLimit_UNKNOWN {
+		limit.Name = strconv.FormatInt(decision.Limit, 10) + ";w=" + strconv.FormatInt(int64(math.Ceil(window.Seconds())), 10)
+	}
+	return limit
+}
+
+// limitWindow devolve a janela em que Limit requisições são aceitas. Nos algoritmos
+// baseados em taxa, é o tempo necessário para repor toda a capacidade de rajada.
+func limitWindow(decision domain.Decision) time.Duration {
+	if span := decision.Tier.Span(); span > 0 {
+		return span
+	}
+	rule := decision.AppliedRule
+	switch rule.Algorithm {
+	case domain.AlgorithmTokenBucket, domain.AlgorithmGCRA:
+		rate, burst := rule.RateAndBurst()
+		return time.Duration(float64(burst) / rate * float64(time.Second))
+	default:
+		return rule.Limits()[0].Span()
+	}
+}
+
+func unitFor(window time.Duration) rlsv3.RateLimitResponse_RateLimit_Unit {
+	switch window {
+	case time.Second:
+		return rlsv3.RateLimitResponse_RateLimit_SECOND
+	case time.Minute:
+		return rlsv3.RateLimitResponse_RateLimit_MINUTE
+	case time.Hour:
+		return rlsv3.RateLimitResponse_RateLimit_HOUR
+	case 24 * time.Hour:
+		return rlsv3.RateLimitResponse_RateLimit_DAY
+	case 7 * 24 * time.Hour:
+		return rlsv3.RateLimitResponse_RateLimit_WEEK
+	default:
+		return rlsv3.RateLimitResponse_RateLimit_UNKNOWN
+	}
+}
+
+func clampUint32(v int64) uint32 {
+	return uint32(min(max(v, 0), math.MaxUint32))
+}
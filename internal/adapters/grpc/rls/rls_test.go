@@ -0,0 +1,186 @@
+package rls
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestShouldRateLimit_MapsDescriptorsToRequests(t *testing.T) {
+	limiter := &stubLimiter{decisions: []domain.Decision{
+		{Allowed: true, Limit: 10, Remaining: 7, ResetAfter: 1500 * time.Millisecond, AppliedRule: domain.RateLimitRule{Requests: 10, Window: time.Second}},
+		{Allowed: true, Limit: 100, Remaining: 99, Tier: domain.Tier{Requests: 100, Window: 30 * time.Second}},
+	}}
+
+	resp, err := NewService(limiter).ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Domain:     "edge",
+		HitsAddend: 2,
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{
+			descriptor(KeyRemoteAddress, "10.0.0.1", "x-unknown", "ignored"),
+			{
+				Entries:    descriptor(KeyToken, "abc", KeyMethod, "POST", KeyRoute, "/export").Entries,
+				HitsAddend: wrapperspb.UInt64(5),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []domain.RateLimitRequest{
+		{IP: "10.0.0.1", Cost: 2},
+		{Token: "abc", Method: "POST", Route: "/export", Cost: 5},
+	}
+	if len(limiter.requests) != len(want) || limiter.requests[0] != want[0] || limiter.requests[1] != want[1] {
+		t.Fatalf("unexpected requests: %+v", limiter.requests)
+	}
+
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OK || len(resp.GetStatuses()) != 2 {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+	first := resp.GetStatuses()[0]
+	if first.GetCurrentLimit().GetRequestsPerUnit() != 10 || first.GetCurrentLimit().GetUnit() != rlsv3.RateLimitResponse_RateLimit_SECOND {
+		t.Fatalf("unexpected current limit: %v", first.GetCurrentLimit())
+	}
+	if first.GetLimitRemaining() != 7 || first.GetDurationUntilReset().AsDuration() != 1500*time.Millisecond {
+		t.Fatalf("unexpected status: %v", first)
+	}
+	second := resp.GetStatuses()[1].GetCurrentLimit()
+	if second.GetUnit() != rlsv3.RateLimitResponse_RateLimit_UNKNOWN || second.GetName() != "100;w=30" {
+		t.Fatalf("expected a named limit for a non-unit window, got %v", second)
+	}
+}
+
+func TestShouldRateLimit_ReportsCalendarPeriods(t *testing.T) {
+	limiter := &stubLimiter{decisions: []domain.Decision{
+		{Allowed: true, Limit: 10000, Remaining: 42, Tier: domain.Tier{Requests: 10000, Period: domain.PeriodMonth}},
+		{Allowed: true, Limit: 500, Remaining: 1, Tier: domain.Tier{Requests: 500, Period: domain.PeriodDay}},
+	}}
+
+	resp, err := NewService(limiter).ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor(KeyToken, "plan"), descriptor(KeyToken, "daily")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []rlsv3.RateLimitResponse_RateLimit_Unit{rlsv3.RateLimitResponse_RateLimit_MONTH, rlsv3.RateLimitResponse_RateLimit_DAY}
+	for i, st := range resp.GetStatuses() {
+		if limit := st.GetCurrentLimit(); limit.GetUnit() != want[i] || limit.GetName() != "" {
+			t.Fatalf("status %d: expected unit %v, got %v", i, want[i], limit)
+		}
+	}
+}
+
+func TestShouldRateLimit_OverLimitWhenAnyDescriptorIsDenied(t *testing.T) {
+	limiter := &stubLimiter{
+		decisions: []domain.Decision{
+			{Allowed: true, Limit: 10, Remaining: 3},
+			{Allowed: false, Limit: 5, RetryAfter: 3 * time.Second},
+			{},
+		},
+		errs: []error{nil, domain.ErrBlocked, domain.ErrDenied},
+	}
+
+	resp, err := NewService(limiter).ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{
+			descriptor(KeyRemoteAddress, "10.0.0.1"),
+			descriptor(KeyToken, "abc"),
+			descriptor(KeyToken, "evil"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Fatalf("expected OVER_LIMIT, got %v", resp.GetOverallCode())
+	}
+	want := []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OVER_LIMIT, rlsv3.RateLimitResponse_OVER_LIMIT}
+	for i, st := range resp.GetStatuses() {
+		if st.GetCode() != want[i] {
+			t.Fatalf("status %d: expected %v, got %v", i, want[i], st.GetCode())
+		}
+	}
+	if got := resp.GetStatuses()[1].GetDurationUntilReset().AsDuration(); got != 3*time.Second {
+		t.Fatalf("expected reset to honour RetryAfter, got %v", got)
+	}
+}
+
+func TestShouldRateLimit_AnswersDelayedRequestsImmediately(t *testing.T) {
+	limiter := &stubLimiter{decisions: []domain.Decision{{Allowed: true, Limit: 10, Remaining: 0, Delay: 300 * time.Millisecond}}}
+
+	start := time.Now()
+	resp, err := NewService(limiter).ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor(KeyToken, "batch")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+		t.Fatalf("expected no wait for the delay, took %v", elapsed)
+	}
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OK || resp.GetStatuses()[0].GetCode() != rlsv3.RateLimitResponse_OK {
+		t.Fatalf("expected a delayed decision to be answered OK, got %v", resp)
+	}
+}
+
+func TestShouldRateLimit_MapsErrorsToStatusCodes(t *testing.T) {
+	tests := map[string]struct {
+		descriptor *ratelimitv3.RateLimitDescriptor
+		err        error
+		code       codes.Code
+	}{
+		"missing identifier": {descriptor: descriptor(KeyMethod, "GET"), code: codes.InvalidArgument},
+		"negative hits":      {descriptor: &ratelimitv3.RateLimitDescriptor{Entries: descriptor(KeyToken, "abc").Entries, IsNegativeHits: true}, code: codes.InvalidArgument},
+		"storage down":       {descriptor: descriptor(KeyToken, "abc"), err: fmt.Errorf("%w: timeout", domain.ErrUnavailable), code: codes.Unavailable},
+		"invalid request":    {descriptor: descriptor(KeyToken, "abc"), err: fmt.Errorf("%w: ip address is required", domain.ErrInvalidRequest), code: codes.InvalidArgument},
+		"unexpected failure": {descriptor: descriptor(KeyToken, "abc"), err: fmt.Errorf("boom"), code: codes.Internal},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			limiter := &stubLimiter{decisions: []domain.Decision{{}}, errs: []error{tc.err}}
+			_, err := NewService(limiter).ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+				Descriptors: []*ratelimitv3.RateLimitDescriptor{tc.descriptor},
+			})
+			if status.Code(err) != tc.code {
+				t.Fatalf("expected %v, got %v", tc.code, err)
+			}
+		})
+	}
+}
+
+func descriptor(kv ...string) *ratelimitv3.RateLimitDescriptor {
+	d := &ratelimitv3.RateLimitDescriptor{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		d.Entries = append(d.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: kv[i], Value: kv[i+1]})
+	}
+	return d
+}
+
+type stubLimiter struct {
+	decisions []domain.Decision
+	errs      []error
+	requests  []domain.RateLimitRequest
+}
+
+func (s *stubLimiter) Allow(_ context.Context, req domain.RateLimitRequest) (domain.Decision, error) {
+	i := len(s.requests)
+	s.requests = append(s.requests, req)
+
+	var err error
+	if i < len(s.errs) {
+		err = s.errs[i]
+	}
+	return s.decisions[i], err
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+// NewAdminRouter expõe as operações administrativas do limiter. Os identificadores são
+// informados pelos parâmetros de query "type" (ip, token ou token_ip) e "id". A
+// autenticação fica a cargo de quem monta o router.
+//
+//	GET  /state    contadores e bloqueios do identificador
+//	POST /unblock  remove os bloqueios do identificador
+//	POST /reset    zera os contadores do identificador
+//	GET  /blocked  lista os identificadores bloqueados
+func NewAdminRouter(admin ports.LimiterAdmin) chi.Router {
+	h := adminHandler{admin: admin}
+
+	r := chi.NewRouter()
+	r.Get("/state", h.state)
+	r.Post("/unblock", h.unblock)
+	r.Post("/reset", h.reset)
+	r.Get("/blocked", h.blocked)
+	return r
+}
+
+type adminHandler struct {
+	admin ports.LimiterAdmin
+}
+
+type identifierStateResponse struct {
+	Identifier string                 `json:"identifier"`
+	Type       domain.IdentifierType  `json:"type"`
+	Counters   []counterStateResponse `json:"counters"`
+	Blocks     []blockResponse        `json:"blocks"`
+}
+
+type counterStateResponse struct {
+	Route      string `json:"route,omitempty"`
+	Key        string `json:"key"`
+	Count      int64  `json:"count"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+type blockResponse struct {
+	Identifier string                `json:"identifier"`
+	Type       domain.IdentifierType `json:"type"`
+	Route      string                `json:"route,omitempty"`
+	TTLSeconds int64                 `json:"ttl_seconds"`
+}
+
+func (h adminHandler) state(w http.ResponseWriter, r *http.Request) {
+	identifierType, identifier := identifierParams(r)
+	state, err := h.admin.Inspect(r.Context(), identifierType, identifier)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	resp := identifierStateResponse{
+		Identifier: state.Identifier,
+		Type:       state.IdentifierType,
+		Counters:   make([]counterStateResponse, 0, len(state.Counters)),
+		Blocks:     make([]blockResponse, 0, len(state.Blocks)),
+	}
+	for _, c := range state.Counters {
+		resp.Counters = append(resp.Counters, counterStateResponse{Route: c.Route, Key: c.Key, Count: c.Count, TTLSeconds: ttlSeconds(c.TTL)})
+	}
+	for _, b := range state.Blocks {
+		resp.Blocks = append(resp.Blocks, newBlockResponse(b))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h adminHandler) unblock(w http.ResponseWriter, r *http.Request) {
+	identifierType, identifier := identifierParams(r)
+	if err := h.admin.Unblock(r.Context(), identifierType, identifier); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h adminHandler) reset(w http.ResponseWriter, r *http.Request) {
+	identifierType, identifier := identifierParams(r)
+	if err := h.admin.Reset(r.Context(), identifierType, identifier); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h adminHandler) blocked(w http.ResponseWriter, r *http.Request) {
+	blocks, err := h.admin.ListBlocked(r.Context())
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	resp := make([]blockResponse, 0, len(blocks))
+	for _, b := range blocks {
+		resp = append(resp, newBlockResponse(b))
+	}
+	writeJSON(w, http.StatusOK, map[string][]blockResponse{"blocked": resp})
+}
+
+func identifierParams(r *http.Request) (domain.IdentifierType, string) {
+	query := r.URL.Query()
+	return domain.IdentifierType(query.Get("type")), query.Get("id")
+}
+
+func newBlockResponse(b domain.BlockState) blockResponse {
+	return blockResponse{Identifier: b.Identifier, Type: b.IdentifierType, Route: b.Route, TTLSeconds: ttlSeconds(b.TTL)}
+}
+
+// ttlSeconds arredonda para cima, para que um TTL residual não apareça como zero.
+// Chaves sem expiração são reportadas como -1.
+func ttlSeconds(ttl time.Duration) int64 {
+	if ttl < 0 {
+		return -1
+	}
+	return int64(math.Ceil(ttl.Seconds()))
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrInvalidIdentifier) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("admin operation failed: %v", err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": http.StatusText(http.StatusInternalServerError)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
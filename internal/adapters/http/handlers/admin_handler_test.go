@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestAdminRouter_State(t *testing.T) {
+	admin := &fakeAdmin{state: domain.IdentifierState{
+		Identifier:     "10.0.0.1",
+		IdentifierType: domain.IdentifierIP,
+		Counters:       []domain.CounterState{{Key: "ratelimit:{ip:10.0.0.1}", Count: 3, TTL: 1500 * time.Millisecond}},
+		Blocks:         []domain.BlockState{{Identifier: "10.0.0.1", IdentifierType: domain.IdentifierIP, TTL: time.Minute}},
+	}}
+	rec := serveAdmin(admin, http.MethodGet, "/state?type=ip&id=10.0.0.1")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if admin.called != "inspect ip 10.0.0.1" {
+		t.Fatalf("unexpected call: %q", admin.called)
+	}
+
+	var body identifierStateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(body.Counters) != 1 || body.Counters[0].Count != 3 || body.Counters[0].TTLSeconds != 2 {
+		t.Fatalf("unexpected counters: %+v", body.Counters)
+	}
+	if len(body.Blocks) != 1 || body.Blocks[0].TTLSeconds != 60 {
+		t.Fatalf("unexpected blocks: %+v", body.Blocks)
+	}
+}
+
+func TestAdminRouter_UnblockAndReset(t *testing.T) {
+	for path, want := range map[string]string{
+		"/unblock?type=token&id=abc": "unblock token abc",
+		"/reset?type=token&id=abc":   "reset token abc",
+	} {
+		admin := &fakeAdmin{}
+		rec := serveAdmin(admin, http.MethodPost, path)
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected status 204, got %d", path, rec.Code)
+		}
+		if admin.called != want {
+			t.Fatalf("%s: unexpected call %q", path, admin.called)
+		}
+	}
+}
+
+func TestAdminRouter_Blocked(t *testing.T) {
+	admin := &fakeAdmin{blocks: []domain.BlockState{
+		{Identifier: "abc", IdentifierType: domain.IdentifierToken, Route: "POST /export", TTL: time.Second},
+	}}
+	rec := serveAdmin(admin, http.MethodGet, "/blocked")
+
+	var body map[string][]blockResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	want := blockResponse{Identifier: "abc", Type: domain.IdentifierToken, Route: "POST /export", TTLSeconds: 1}
+	if len(body["blocked"]) != 1 || body["blocked"][0] != want {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+}
+
+func TestAdminRouter_MapsErrors(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		status int
+	}{
+		"invalid identifier": {err: fmt.Errorf("%w: unknown type", domain.ErrInvalidIdentifier), status: http.StatusBadRequest},
+		"storage failure":    {err: errors.New("connection refused"), status: http.StatusInternalServerError},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := serveAdmin(&fakeAdmin{err: tc.err}, http.MethodPost, "/reset?type=user&id=x")
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, rec.Code)
+			}
+		})
+	}
+}
+
+func serveAdmin(admin *fakeAdmin, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	NewAdminRouter(admin).ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+type fakeAdmin struct {
+	state  domain.IdentifierState
+	blocks []domain.BlockState
+	err    error
+	called string
+}
+
+func (f *fakeAdmin) Inspect(_ context.Context, identifierType domain.IdentifierType, identifier string) (domain.IdentifierState, error) {
+	f.called = fmt.Sprintf("inspect %s %s", identifierType, identifier)
+	return f.state, f.err
+}
+
+func (f *fakeAdmin) Unblock(_ context.Context, identifierType domain.IdentifierType, identifier string) error {
+	f.called = fmt.Sprintf("unblock %s %s", identifierType, identifier)
+	return f.err
+}
+
+func (f *fakeAdmin) Reset(_ context.Context, identifierType domain.IdentifierType, identifier string) error {
+	f.called = fmt.Sprintf("reset %s %s", identifierType, identifier)
+	return f.err
+}
+
+func (f *fakeAdmin) ListBlocked(context.Context) ([]domain.BlockState, error) {
+	return f.blocks, f.err
+}
@@ -1,4 +1,4 @@
-// Package handlers agrupa handlers HTTP utilizados para testes e exemplo.
+// Package handlers agrupa os handlers HTTP: o endpoint de exemplo e a API administrativa.
 package handlers
 
 import (
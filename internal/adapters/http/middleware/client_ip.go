@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Headers consultados por padrão, em ordem, quando a conexão vem de um proxy confiável.
+var defaultClientIPHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+
+// clientIPResolver descobre o IP do cliente levando em conta apenas proxies confiáveis.
+// Headers de encaminhamento são ignorados quando a conexão não vem de um desses proxies,
+// já que qualquer cliente pode enviá-los.
+type clientIPResolver struct {
+	trusted []netip.Prefix
+	headers []string
+}
+
+func (c clientIPResolver) clientIP(r *http.Request) string {
+	remote, ok := parseIP(r.RemoteAddr)
+	if !ok {
+		return strings.TrimSpace(r.RemoteAddr)
+	}
+	if !c.isTrusted(remote) {
+		return remote.String()
+	}
+
+	for _, header := range c.headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		var hops []string
+		switch http.CanonicalHeaderKey(header) {
+		case "Forwarded":
+			hops = forwardedFor(values)
+		default:
+			hops = splitList(values)
+		}
+		if len(hops) > 0 {
+			return c.walk(remote, hops).String()
+		}
+	}
+
+	return remote.String()
+}
+
+// walk percorre a cadeia de hops da direita para a esquerda, pulando os proxies
+// confiáveis, e devolve o primeiro endereço não confiável. Valores inválidos (como
+// "unknown") encerram a busca no último endereço conhecido.
+func (c clientIPResolver) walk(remote netip.Addr, hops []string) netip.Addr {
+	current := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseIP(hops[i])
+		if !ok {
+			return current
+		}
+		current = addr
+		if !c.isTrusted(addr) {
+			return addr
+		}
+	}
+	return current
+}
+
+func (c clientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor extrai os parâmetros "for" do header Forwarded (RFC 7239), na ordem
+// em que os proxies os adicionaram.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && strings.EqualFold(strings.TrimSpace(key), "for") {
+				hops = append(hops, strings.Trim(strings.TrimSpace(value), `"`))
+			}
+		}
+	}
+	return hops
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// parseIP aceita um IP puro ou acompanhado de porta, com ou sem colchetes no caso do IPv6.
+func parseIP(raw string) (netip.Addr, bool) {
+	raw = strings.TrimSpace(raw)
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		raw = host
+	}
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]")
+
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
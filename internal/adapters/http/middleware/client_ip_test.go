@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		trusted []netip.Prefix
+		want    string
+	}{
+		{
+			name:    "ignores forwarded headers without trusted proxies",
+			remote:  "203.0.113.7:4242",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "ignores forwarded headers from untrusted peers",
+			remote:  "203.0.113.7:4242",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			trusted: proxies,
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "walks X-Forwarded-For right to left skipping trusted hops",
+			remote:  "10.0.0.1:4242",
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.9, 10.0.0.5"},
+			trusted: proxies,
+			want:    "198.51.100.9",
+		},
+		{
+			name:    "returns leftmost hop when every hop is trusted",
+			remote:  "10.0.0.1:4242",
+			headers: map[string]string{"X-Forwarded-For": "10.1.1.1, 10.0.0.5"},
+			trusted: proxies,
+			want:    "10.1.1.1",
+		},
+		{
+			name:    "stops at invalid hops",
+			remote:  "10.0.0.1:4242",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.9, unknown, 10.0.0.5"},
+			trusted: proxies,
+			want:    "10.0.0.5",
+		},
+		{
+			name:   "parses RFC 7239 Forwarded",
+			remote: "[2001:db8:ffff::1]:443",
+			headers: map[string]string{
+				"Forwarded":       `for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			trusted: proxies,
+			want:    "2001:db8:cafe::17",
+		},
+		{
+			name:    "falls back to X-Real-IP",
+			remote:  "10.0.0.1:4242",
+			headers: map[string]string{"X-Real-IP": "198.51.100.3"},
+			trusted: proxies,
+			want:    "198.51.100.3",
+		},
+		{
+			name:   "normalises IPv4-mapped IPv6 remote addresses",
+			remote: "[::ffff:203.0.113.8]:80",
+			want:   "203.0.113.8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			resolver := clientIPResolver{trusted: tt.trusted, headers: defaultClientIPHeaders}
+			if got := resolver.clientIP(req); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClientIP_RespectsConfiguredHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:4242"
+	req.Header.Set("Forwarded", "for=192.0.2.1")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	resolver := clientIPResolver{
+		trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		headers: []string{"X-Forwarded-For"},
+	}
+	if got := resolver.clientIP(req); got != "198.51.100.1" {
+		t.Fatalf("expected only X-Forwarded-For to be honoured, got %s", got)
+	}
+}
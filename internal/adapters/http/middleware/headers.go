@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+// writeRateLimitHeaders publica o estado do limite para que os clientes possam
+// desacelerar antes de serem bloqueados. Retry-After só é enviado em respostas
+// negadas, onde tem significado segundo a RFC 9110. X-RateLimit-Reset parte do
+// instante da decisão (Decision.ResetAt), e não do momento em que a resposta é escrita.
+func writeRateLimitHeaders(w http.ResponseWriter, decision domain.Decision, cfg options) {
+	if decision.Limit <= 0 {
+		return
+	}
+
+	reset := decision.ResetAfter
+	if !decision.Allowed {
+		reset = max(reset, decision.RetryAfter)
+	}
+	resetSeconds := ceilSeconds(reset)
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.FormatInt(decision.Limit, 10))
+	h.Set("X-RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(resetAt(decision).Unix(), 10))
+
+	if !decision.Allowed {
+		h.Set("Retry-After", strconv.FormatInt(max(ceilSeconds(decision.RetryAfter), 1), 10))
+	}
+
+	if cfg.ietfHeaders {
+		h.Set("RateLimit", fmt.Sprintf("limit=%d, remaining=%d, reset=%d", decision.Limit, decision.Remaining, resetSeconds))
+		h.Set("RateLimit-Policy", rateLimitPolicy(decision))
+	}
+}
+
+// resetAt devolve o instante em que o limite volta ao estado inicial. Em negações cujo
+// RetryAfter (como um bloqueio) passa do reset dos contadores, vale o RetryAfter.
+func resetAt(decision domain.Decision) time.Time {
+	at := decision.ResetAt
+	if at.IsZero() {
+		at = time.Now().Add(decision.ResetAfter)
+	}
+	if !decision.Allowed && decision.RetryAfter > decision.ResetAfter {
+		at = at.Add(decision.RetryAfter - decision.ResetAfter)
+	}
+	return at
+}
+
+// rateLimitPolicy descreve a política aplicada. Regras com vários tiers listam todos,
+// começando pelo tier ao qual RateLimit se refere. Períodos de calendário são descritos
+// pela duração nominal.
+func rateLimitPolicy(decision domain.Decision) string {
+	rule := decision.AppliedRule
+	if len(rule.Tiers) == 0 {
+		return fmt.Sprintf("%d;w=%d", decision.Limit, ceilSeconds(policyWindow(rule)))
+	}
+
+	policies := []string{fmt.Sprintf("%d;w=%d", decision.Tier.Requests, ceilSeconds(decision.Tier.Span()))}
+	for _, tier := range rule.Limits() {
+		if tier != decision.Tier {
+			policies = append(policies, fmt.Sprintf("%d;w=%d", tier.Requests, ceilSeconds(tier.Span())))
+		}
+	}
+	return strings.Join(policies, ", ")
+}
+
+// policyWindow devolve a janela em que Limit requisições são aceitas. Nos algoritmos
+// baseados em taxa, é o tempo necessário para repor toda a capacidade de rajada.
+func policyWindow(rule domain.RateLimitRule) time.Duration {
+	switch rule.Algorithm {
+	case domain.AlgorithmTokenBucket, domain.AlgorithmGCRA:
+		rate, burst := rule.RateAndBurst()
+		return time.Duration(float64(burst) / rate * float64(time.Second))
+	default:
+		return rule.Limits()[0].Span()
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -2,18 +2,96 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"log"
-	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
 	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
 )
 
-const rateLimitExceededMessage = "you have reached the maximum number of requests or actions allowed within a certain time frame"
+const (
+	rateLimitExceededMessage = "you have reached the maximum number of requests or actions allowed within a certain time frame"
+	concurrencyLimitMessage  = "too many concurrent requests"
+	accessDeniedMessage      = "access denied"
+	unavailableMessage       = "rate limiter is temporarily unavailable"
+
+	concurrencyRetryAfter = "1"
+)
+
+// Option personaliza o comportamento do middleware de rate limiting.
+type Option func(*options)
+
+type options struct {
+	ietfHeaders bool
+	ipResolver  clientIPResolver
+	costFunc    func(*http.Request) int64
+	costHeader  string
+	concurrency ports.ConcurrencyLimiter
+}
+
+// WithTrustedProxies define os proxies cujos headers de encaminhamento são aceitos.
+// Sem proxies confiáveis, o IP do cliente é sempre o da conexão (RemoteAddr).
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(o *options) {
+		o.ipResolver.trusted = append(o.ipResolver.trusted, prefixes...)
+	}
+}
+
+// WithClientIPHeaders define, em ordem de prioridade, os headers consultados quando a
+// requisição vem de um proxy confiável. O padrão é Forwarded, X-Forwarded-For e X-Real-IP;
+// restrinja-os aos headers que o seu proxy de fato sobrescreve.
+func WithClientIPHeaders(headers ...string) Option {
+	return func(o *options) {
+		o.ipResolver.headers = headers
+	}
+}
+
+// WithIETFHeaders passa a emitir também os headers RateLimit e RateLimit-Policy
+// do draft da IETF (draft-ietf-httpapi-ratelimit-headers).
+func WithIETFHeaders() Option {
+	return func(o *options) {
+		o.ietfHeaders = true
+	}
+}
+
+// WithCostFunc define quanto da cota cada requisição consome. Um retorno menor ou
+// igual a zero mantém o custo configurado para a rota (ou 1).
+func WithCostFunc(fn func(*http.Request) int64) Option {
+	return func(o *options) {
+		o.costFunc = fn
+	}
+}
+
+// WithCostHeader lê o custo da requisição de um header, quando WithCostFunc não
+// define outro valor. Como o cliente controla os headers, use apenas quando ele é
+// preenchido por um componente confiável, como um gateway.
+func WithCostHeader(name string) Option {
+	return func(o *options) {
+		o.costHeader = name
+	}
+}
+
+// WithConcurrencyLimiter limita também as requisições em andamento: uma vaga é ocupada
+// antes de consultar o rate limiter e devolvida quando a requisição termina, inclusive
+// quando ela é recusada. A vaga fica ocupada durante uma eventual espera de Decision.Delay.
+func WithConcurrencyLimiter(limiter ports.ConcurrencyLimiter) Option {
+	return func(o *options) {
+		o.concurrency = limiter
+	}
+}
+
+func NewRateLimiterMiddleware(limiter ports.RateLimiter, opts ...Option) func(http.Handler) http.Handler {
+	cfg := options{ipResolver: clientIPResolver{headers: defaultClientIPHeaders}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 
-func NewRateLimiterMiddleware(limiter ports.RateLimiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if limiter == nil {
@@ -21,51 +99,139 @@ func NewRateLimiterMiddleware(limiter ports.RateLimiter) func(http.Handler) http
 				return
 			}
 
-			ip := extractIP(r)
+			ip := cfg.ipResolver.clientIP(r)
 			token := strings.TrimSpace(r.Header.Get("API_KEY"))
 
-			decision, err := limiter.Allow(r.Context(), domain.RateLimitRequest{IP: ip, Token: token})
+			req := domain.RateLimitRequest{
+				IP:     ip,
+				Token:  token,
+				Method: r.Method,
+				Route:  routePattern(r),
+				Cost:   cfg.requestCost(r),
+			}
+			// A vaga é ocupada antes de consumir a cota, para que uma requisição recusada
+			// por concorrência não gaste cota; ela é devolvida em qualquer saída.
+			if cfg.concurrency != nil {
+				lease, err := cfg.concurrency.Acquire(r.Context(), req)
+				if err != nil {
+					writeConcurrencyError(w, err)
+					return
+				}
+				defer func() {
+					// A vaga é devolvida mesmo que o cliente tenha desconectado.
+					if err := cfg.concurrency.Release(context.WithoutCancel(r.Context()), lease); err != nil {
+						log.Printf("failed to release concurrency slot: %v", err)
+					}
+				}()
+			}
+
+			decision, err := limiter.Allow(r.Context(), req)
 			if err != nil {
 				if domain.IsBlockedError(err) {
+					writeRateLimitHeaders(w, decision, cfg)
 					writeTooManyRequests(w)
 					return
 				}
+				if domain.IsDeniedError(err) {
+					writeForbidden(w)
+					return
+				}
+				if errors.Is(err, domain.ErrUnavailable) {
+					log.Printf("rate limiter unavailable: %v", err)
+					writeUnavailable(w)
+					return
+				}
+				if errors.Is(err, domain.ErrInvalidRequest) {
+					http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+					return
+				}
 
 				log.Printf("rate limiter failed: %v", err)
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
 
+			writeRateLimitHeaders(w, decision, cfg)
 			if !decision.Allowed {
 				writeTooManyRequests(w)
 				return
 			}
 
+			// Em regras com espera máxima, a requisição aguarda a vez que lhe foi reservada.
+			// Se o cliente desistir antes, ela é recusada como as demais negações. A vez não
+			// é devolvida: as reservas seguintes já foram calculadas depois dela no GCRA.
+			if !delay(r.Context(), decision.Delay) {
+				w.Header().Set("Retry-After", strconv.FormatInt(max(ceilSeconds(decision.Delay), 1), 10))
+				writeTooManyRequests(w)
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func extractIP(r *http.Request) string {
-	xForwardedFor := strings.TrimSpace(r.Header.Get("X-Forwarded-For"))
-	if xForwardedFor != "" {
-		parts := strings.Split(xForwardedFor, ",")
-		if len(parts) > 0 {
-			return strings.TrimSpace(parts[0])
+func (o options) requestCost(r *http.Request) int64 {
+	if o.costFunc != nil {
+		if cost := o.costFunc(r); cost > 0 {
+			return cost
+		}
+	}
+	if o.costHeader != "" {
+		if cost, err := strconv.ParseInt(strings.TrimSpace(r.Header.Get(o.costHeader)), 10, 64); err == nil && cost > 0 {
+			return cost
 		}
 	}
+	return 0
+}
 
-	xRealIP := strings.TrimSpace(r.Header.Get("X-Real-IP"))
-	if xRealIP != "" {
-		return xRealIP
+// delay espera d ou até o contexto ser cancelado, devolvendo false no segundo caso.
+func delay(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
+}
 
-	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
-	if err != nil {
-		return strings.TrimSpace(r.RemoteAddr)
+func writeConcurrencyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrConcurrencyLimit):
+		// Não há como saber quando uma vaga será liberada; 1 segundo evita novas
+		// tentativas imediatas sem segurar o cliente por muito tempo.
+		w.Header().Set("Retry-After", concurrencyRetryAfter)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(concurrencyLimitMessage))
+	case domain.IsDeniedError(err):
+		writeForbidden(w)
+	case errors.Is(err, domain.ErrUnavailable):
+		log.Printf("rate limiter unavailable: %v", err)
+		writeUnavailable(w)
+	case errors.Is(err, domain.ErrInvalidRequest):
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	default:
+		log.Printf("concurrency limiter failed: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
+}
+
+func writeForbidden(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write([]byte(accessDeniedMessage))
+}
 
-	return host
+func writeUnavailable(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte(unavailableMessage))
 }
 
 func writeTooManyRequests(w http.ResponseWriter) {
@@ -0,0 +1,350 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestMiddleware_WritesRateLimitHeadersOnSuccess(t *testing.T) {
+	limiter := &stubLimiter{decision: domain.Decision{
+		Allowed:    true,
+		Limit:      10,
+		Remaining:  7,
+		ResetAfter: 1500 * time.Millisecond,
+	}}
+
+	rec := serve(t, limiter)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	assertHeader(t, rec, "X-RateLimit-Limit", "10")
+	assertHeader(t, rec, "X-RateLimit-Remaining", "7")
+	if rec.Header().Get("X-RateLimit-Reset") == "" {
+		t.Fatalf("expected X-RateLimit-Reset to be set")
+	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Fatalf("expected no Retry-After on allowed responses, got %q", got)
+	}
+	if got := rec.Header().Get("RateLimit"); got != "" {
+		t.Fatalf("expected IETF headers to be disabled by default, got %q", got)
+	}
+}
+
+func TestMiddleware_WritesRetryAfterWhenBlocked(t *testing.T) {
+	limiter := &stubLimiter{
+		decision: domain.Decision{
+			Allowed:    false,
+			Limit:      10,
+			RetryAfter: 4200 * time.Millisecond,
+		},
+		err: domain.ErrBlocked,
+	}
+
+	rec := serve(t, limiter)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	assertHeader(t, rec, "X-RateLimit-Remaining", "0")
+	assertHeader(t, rec, "Retry-After", "5")
+}
+
+func TestMiddleware_DerivesResetFromDecisionTime(t *testing.T) {
+	decidedAt := time.Unix(1_700_000_000, 0)
+	tests := map[string]struct {
+		decision domain.Decision
+		err      error
+		want     string
+	}{
+		"allowed": {
+			decision: domain.Decision{Allowed: true, Limit: 10, ResetAfter: 30 * time.Second, ResetAt: decidedAt.Add(30 * time.Second)},
+			want:     "1700000030",
+		},
+		"blocked past the window": {
+			decision: domain.Decision{Limit: 10, ResetAfter: 30 * time.Second, RetryAfter: 90 * time.Second, ResetAt: decidedAt.Add(30 * time.Second)},
+			err:      domain.ErrBlocked,
+			want:     "1700000090",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := serve(t, &stubLimiter{decision: tc.decision, err: tc.err})
+			assertHeader(t, rec, "X-RateLimit-Reset", tc.want)
+		})
+	}
+}
+
+func TestMiddleware_RespondsForbiddenWhenDenyListed(t *testing.T) {
+	limiter := &stubLimiter{
+		decision: domain.Decision{Allowed: false, Reason: domain.ReasonDenyList},
+		err:      domain.ErrDenied,
+	}
+
+	rec := serve(t, limiter)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Fatalf("expected no Retry-After on denied responses, got %q", got)
+	}
+}
+
+func TestMiddleware_RespondsServiceUnavailableWhenStorageFails(t *testing.T) {
+	limiter := &stubLimiter{
+		decision: domain.Decision{Reason: domain.ReasonStorageUnavailable},
+		err:      fmt.Errorf("%w: connection refused", domain.ErrUnavailable),
+	}
+
+	rec := serve(t, limiter)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_RespondsBadRequestWhenRequestIsInvalid(t *testing.T) {
+	limiter := &stubLimiter{err: fmt.Errorf("%w: request cost 5 exceeds the ip rule capacity of 3", domain.ErrInvalidRequest)}
+
+	rec := serve(t, limiter)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_WritesIETFHeaders(t *testing.T) {
+	limiter := &stubLimiter{decision: domain.Decision{
+		Allowed:     true,
+		AppliedRule: domain.RateLimitRule{Requests: 10, Window: time.Minute},
+		Limit:       10,
+		Remaining:   3,
+		ResetAfter:  30 * time.Second,
+	}}
+
+	rec := serve(t, limiter, WithIETFHeaders())
+
+	assertHeader(t, rec, "RateLimit", "limit=10, remaining=3, reset=30")
+	assertHeader(t, rec, "RateLimit-Policy", "10;w=60")
+}
+
+func TestMiddleware_WritesPolicyForEveryTier(t *testing.T) {
+	tier := domain.Tier{Requests: 1000, Window: time.Hour}
+	limiter := &stubLimiter{decision: domain.Decision{
+		Allowed: true,
+		AppliedRule: domain.RateLimitRule{
+			Requests: 10,
+			Window:   time.Second,
+			Tiers:    []domain.Tier{tier},
+		},
+		Limit:      1000,
+		Remaining:  2,
+		ResetAfter: 20 * time.Minute,
+		Tier:       tier,
+	}}
+
+	rec := serve(t, limiter, WithIETFHeaders())
+
+	assertHeader(t, rec, "RateLimit", "limit=1000, remaining=2, reset=1200")
+	assertHeader(t, rec, "RateLimit-Policy", "1000;w=3600, 10;w=1")
+}
+
+func TestMiddleware_ForwardsRequestCost(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		header string
+		want   int64
+	}{
+		{name: "defaults to zero", header: "5", want: 0},
+		{name: "reads configured header", opts: []Option{WithCostHeader("X-Cost")}, header: "5", want: 5},
+		{name: "ignores invalid header", opts: []Option{WithCostHeader("X-Cost")}, header: "-2", want: 0},
+		{
+			name:   "cost func takes precedence",
+			opts:   []Option{WithCostHeader("X-Cost"), WithCostFunc(func(*http.Request) int64 { return 10 })},
+			header: "5",
+			want:   10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &stubLimiter{decision: domain.Decision{Allowed: true}}
+			handler := NewRateLimiterMiddleware(limiter, tt.opts...)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodPost, "/bulk", nil)
+			req.Header.Set("X-Cost", tt.header)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := limiter.requests[0].Cost; got != tt.want {
+				t.Fatalf("expected cost %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware_DelaysRequestsBeforeForwarding(t *testing.T) {
+	limiter := &stubLimiter{decision: domain.Decision{Allowed: true, Limit: 2, Delay: 30 * time.Millisecond}}
+
+	start := time.Now()
+	rec := serve(t, limiter)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("expected the request to be held for the delay, took %v", elapsed)
+	}
+}
+
+func TestMiddleware_AbandonsDelayedRequestWhenClientGoesAway(t *testing.T) {
+	limiter := &stubLimiter{decision: domain.Decision{Allowed: true, Limit: 2, Delay: time.Minute}}
+
+	var called bool
+	handler := NewRateLimiterMiddleware(limiter)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil).WithContext(ctx))
+
+	if called {
+		t.Fatal("expected the handler not to run after the client went away")
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	assertHeader(t, rec, "Retry-After", "60")
+}
+
+func TestMiddleware_HoldsConcurrencySlotWhileHandling(t *testing.T) {
+	concurrency := &stubConcurrency{lease: domain.Lease{Key: "slots", ID: "1"}}
+	limiter := &stubLimiter{decision: domain.Decision{Allowed: true}}
+
+	var heldDuringHandler bool
+	handler := NewRateLimiterMiddleware(limiter, WithConcurrencyLimiter(concurrency))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		heldDuringHandler = concurrency.acquired == 1 && len(concurrency.released) == 0
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/export", nil))
+
+	if rec.Code != http.StatusOK || !heldDuringHandler {
+		t.Fatalf("expected the slot to be held while handling, status=%d held=%v", rec.Code, heldDuringHandler)
+	}
+	if len(concurrency.released) != 1 || concurrency.released[0] != concurrency.lease {
+		t.Fatalf("expected the slot to be released, got %+v", concurrency.released)
+	}
+}
+
+func TestMiddleware_RejectsWhenConcurrencyLimitIsReached(t *testing.T) {
+	concurrency := &stubConcurrency{err: domain.ErrConcurrencyLimit}
+	limiter := &stubLimiter{decision: domain.Decision{Allowed: true}}
+	rec := serve(t, limiter, WithConcurrencyLimiter(concurrency))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	assertHeader(t, rec, "Retry-After", "1")
+	if len(limiter.requests) != 0 {
+		t.Fatalf("expected no quota to be charged, got %d calls", len(limiter.requests))
+	}
+	if len(concurrency.released) != 0 {
+		t.Fatalf("expected nothing to be released, got %+v", concurrency.released)
+	}
+}
+
+func TestMiddleware_RespondsBadRequestWhenConcurrencyRequestIsInvalid(t *testing.T) {
+	concurrency := &stubConcurrency{err: fmt.Errorf("%w: ip address is required when token has no override", domain.ErrInvalidRequest)}
+	limiter := &stubLimiter{decision: domain.Decision{Allowed: true}}
+	rec := serve(t, limiter, WithConcurrencyLimiter(concurrency))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if len(limiter.requests) != 0 {
+		t.Fatalf("expected no quota to be charged, got %d calls", len(limiter.requests))
+	}
+}
+
+func TestMiddleware_ReleasesConcurrencySlotWhenRateLimited(t *testing.T) {
+	tests := map[string]*stubLimiter{
+		"over limit": {decision: domain.Decision{Allowed: false, Limit: 1, RetryAfter: time.Second}},
+		"blocked":    {err: domain.ErrBlocked},
+		"failure":    {err: errors.New("boom")},
+	}
+
+	for name, limiter := range tests {
+		t.Run(name, func(t *testing.T) {
+			concurrency := &stubConcurrency{lease: domain.Lease{Key: "slots", ID: "1"}}
+			rec := serve(t, limiter, WithConcurrencyLimiter(concurrency))
+
+			if rec.Code == http.StatusOK {
+				t.Fatal("expected the request to be rejected")
+			}
+			if len(concurrency.released) != 1 || concurrency.released[0] != concurrency.lease {
+				t.Fatalf("expected the slot to be released, got %+v", concurrency.released)
+			}
+		})
+	}
+}
+
+func serve(t *testing.T, limiter *stubLimiter, opts ...Option) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := NewRateLimiterMiddleware(limiter, opts...)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func assertHeader(t *testing.T, rec *httptest.ResponseRecorder, name, want string) {
+	t.Helper()
+	if got := rec.Header().Get(name); got != want {
+		t.Fatalf("expected %s=%q, got %q", name, want, got)
+	}
+}
+
+type stubLimiter struct {
+	decision domain.Decision
+	err      error
+	requests []domain.RateLimitRequest
+}
+
+func (s *stubLimiter) Allow(_ context.Context, req domain.RateLimitRequest) (domain.Decision, error) {
+	s.requests = append(s.requests, req)
+	return s.decision, s.err
+}
+
+type stubConcurrency struct {
+	lease    domain.Lease
+	err      error
+	acquired int
+	released []domain.Lease
+}
+
+func (s *stubConcurrency) Acquire(context.Context, domain.RateLimitRequest) (domain.Lease, error) {
+	if s.err != nil {
+		return domain.Lease{}, s.err
+	}
+	s.acquired++
+	return s.lease, nil
+}
+
+func (s *stubConcurrency) Release(_ context.Context, lease domain.Lease) error {
+	s.released = append(s.released, lease)
+	return nil
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// routePattern devolve o padrão chi da rota que vai atender a requisição, como
+// "/users/{id}". Dentro de um Group ou With o roteamento já aconteceu e o padrão está
+// no contexto; com r.Use no router principal ele ainda não existe (ou é parcial, em
+// sub-routers montados), e então a rota é procurada na árvore do router.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" && !strings.HasSuffix(pattern, "/*") {
+		return pattern
+	}
+	if rctx.Routes == nil {
+		return ""
+	}
+
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	return rctx.Routes.Find(chi.NewRouteContext(), r.Method, path)
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestMiddleware_ForwardsMethodAndRoutePattern(t *testing.T) {
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	tests := []struct {
+		name  string
+		setup func(r chi.Router, mw func(http.Handler) http.Handler)
+		path  string
+		want  string
+	}{
+		{
+			name: "global middleware",
+			setup: func(r chi.Router, mw func(http.Handler) http.Handler) {
+				r.Use(mw)
+				r.Post("/users/{id}/export", ok)
+			},
+			path: "/users/42/export",
+			want: "/users/{id}/export",
+		},
+		{
+			name: "group middleware",
+			setup: func(r chi.Router, mw func(http.Handler) http.Handler) {
+				r.Group(func(r chi.Router) {
+					r.Use(mw)
+					r.Post("/users/{id}/export", ok)
+				})
+			},
+			path: "/users/42/export",
+			want: "/users/{id}/export",
+		},
+		{
+			name: "mounted sub-router middleware",
+			setup: func(r chi.Router, mw func(http.Handler) http.Handler) {
+				r.Route("/api", func(r chi.Router) {
+					r.Use(mw)
+					r.Post("/users/{id}/export", ok)
+				})
+			},
+			path: "/api/users/42/export",
+			want: "/api/users/{id}/export",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &stubLimiter{decision: domain.Decision{Allowed: true}}
+			router := chi.NewRouter()
+			tt.setup(router, NewRateLimiterMiddleware(limiter))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, nil))
+
+			if len(limiter.requests) != 1 {
+				t.Fatalf("expected one limiter call, got %d", len(limiter.requests))
+			}
+			got := limiter.requests[0]
+			if got.Method != http.MethodPost || got.Route != tt.want {
+				t.Fatalf("expected POST %s, got %s %s", tt.want, got.Method, got.Route)
+			}
+		})
+	}
+}
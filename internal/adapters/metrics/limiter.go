@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+// RateLimiter é um decorator de ports.RateLimiter que contabiliza as decisões.
+type RateLimiter struct {
+	next    ports.RateLimiter
+	metrics *Metrics
+}
+
+var _ ports.RateLimiter = (*RateLimiter)(nil)
+
+func NewRateLimiter(next ports.RateLimiter, metrics *Metrics) *RateLimiter {
+	return &RateLimiter{next: next, metrics: metrics}
+}
+
+func (l *RateLimiter) Allow(ctx context.Context, req domain.RateLimitRequest) (domain.Decision, error) {
+	decision, err := l.next.Allow(ctx, req)
+
+	identifierType := decisionIdentifierType(req, decision, err)
+
+	outcome := OutcomeAllowed
+	switch {
+	case decision.Reason == domain.ReasonAllowList:
+		outcome = OutcomeAllowListed
+	case decision.Reason == domain.ReasonStorageUnavailable && err == nil:
+		outcome = OutcomeFailOpen
+	case decision.Shadowed && err == nil:
+		outcome = OutcomeShadowDenied
+	case decision.Delay > 0 && err == nil:
+		outcome = OutcomeDelayed
+	case domain.IsDeniedError(err):
+		outcome = OutcomeDenyListed
+	case err != nil && !domain.IsBlockedError(err):
+		outcome = OutcomeError
+	case err != nil || !decision.Allowed:
+		outcome = OutcomeDenied
+	}
+
+	l.metrics.observeDecision(string(identifierType), outcome)
+	return decision, err
+}
+
+// decisionIdentifierType devolve o tipo da dimensão que decidiu, que difere do enviado
+// pelo cliente quando um token sem regra própria é limitado pelo IP. Só em erros internos,
+// em que a decisão vem vazia, o tipo é deduzido da requisição.
+func decisionIdentifierType(req domain.RateLimitRequest, decision domain.Decision, err error) domain.IdentifierType {
+	internal := err != nil && !domain.IsBlockedError(err) && !domain.IsDeniedError(err)
+	if decision.IdentifierType != "" && !internal {
+		return decision.IdentifierType
+	}
+	if strings.TrimSpace(req.Token) != "" {
+		return domain.IdentifierToken
+	}
+	return domain.IdentifierIP
+}
@@ -0,0 +1,123 @@
+// Package metrics instrumenta o rate limiter e o storage com métricas Prometheus
+// por meio de decorators, sem alterar o núcleo da aplicação.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ratelimiter"
+
+// Resultados possíveis de uma decisão do limiter.
+const (
+	OutcomeAllowed = "allowed"
+	OutcomeDenied  = "denied"
+	OutcomeError   = "error"
+	// OutcomeAllowListed e OutcomeDenyListed são decisões tomadas pelas listas de
+	// permissão e bloqueio, sem contagem.
+	OutcomeAllowListed = "allowlisted"
+	OutcomeDenyListed  = "denylisted"
+	// OutcomeFailOpen é uma requisição permitida sem limite porque o storage falhou.
+	OutcomeFailOpen = "fail_open"
+	// OutcomeDelayed é uma requisição permitida depois de uma espera para suavizar o tráfego.
+	OutcomeDelayed = "delayed"
+	// OutcomeShadowDenied é uma requisição que seria negada, mas foi permitida pelo modo shadow.
+	OutcomeShadowDenied = "shadow_denied"
+)
+
+// Metrics agrupa os coletores expostos no endpoint /metrics.
+type Metrics struct {
+	registry       *prometheus.Registry
+	decisions      *prometheus.CounterVec
+	storageLatency *prometheus.HistogramVec
+	blocks         *blockTracker
+}
+
+// New cria as métricas em um registry próprio, incluindo os coletores padrão de
+// processo e do runtime Go.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decisions_total",
+			Help:      "Rate limiter decisions by identifier type and outcome.",
+		}, []string{"identifier_type", "outcome"}),
+		storageLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Latency of storage operations.",
+			Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation"}),
+		blocks: newBlockTracker(time.Now),
+	}
+
+	m.registry.MustRegister(
+		m.decisions,
+		m.storageLatency,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "blocked_identifiers",
+			Help:      "Identifiers currently blocked by this instance.",
+		}, func() float64 { return float64(m.blocks.count()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler expõe as métricas no formato texto do Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) observeDecision(identifierType, outcome string) {
+	m.decisions.WithLabelValues(identifierType, outcome).Inc()
+}
+
+func (m *Metrics) observeStorage(operation string, start time.Time) {
+	m.storageLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// blockTracker acompanha as chaves de bloqueio aplicadas por esta instância e
+// até quando cada uma permanece válida.
+type blockTracker struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	expiry map[string]time.Time
+}
+
+func newBlockTracker(now func() time.Time) *blockTracker {
+	return &blockTracker{now: now, expiry: make(map[string]time.Time)}
+}
+
+func (b *blockTracker) set(key string, ttl time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ttl <= 0 {
+		delete(b.expiry, key)
+		return
+	}
+	b.expiry[key] = b.now().Add(ttl)
+}
+
+func (b *blockTracker) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	for key, expiresAt := range b.expiry {
+		if !now.Before(expiresAt) {
+			delete(b.expiry, key)
+		}
+	}
+	return len(b.expiry)
+}
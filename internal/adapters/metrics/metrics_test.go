@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/memory"
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+func TestRateLimiter_CountsDecisionsByOutcome(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	NewRateLimiter(stubLimiter{decision: domain.Decision{Allowed: true, IdentifierType: domain.IdentifierToken}}, m).
+		Allow(ctx, domain.RateLimitRequest{Token: "abc"})
+	// A token without a rule of its own is limited by the IP and counted as such.
+	NewRateLimiter(stubLimiter{decision: domain.Decision{Allowed: true, IdentifierType: domain.IdentifierIP}}, m).
+		Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.5", Token: "unknown"})
+	NewRateLimiter(stubLimiter{err: domain.ErrBlocked}, m).
+		Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1"})
+	NewRateLimiter(stubLimiter{err: errors.New("storage down")}, m).
+		Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1"})
+	NewRateLimiter(stubLimiter{decision: domain.Decision{Allowed: true, Reason: domain.ReasonAllowList}}, m).
+		Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.2"})
+	NewRateLimiter(stubLimiter{decision: domain.Decision{Reason: domain.ReasonDenyList}, err: domain.ErrDenied}, m).
+		Allow(ctx, domain.RateLimitRequest{Token: "bad"})
+	NewRateLimiter(stubLimiter{decision: domain.Decision{Allowed: true, Reason: domain.ReasonStorageUnavailable}}, m).
+		Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.3"})
+	NewRateLimiter(stubLimiter{decision: domain.Decision{Allowed: true, Shadowed: true, IdentifierType: domain.IdentifierToken}}, m).
+		Allow(ctx, domain.RateLimitRequest{Token: "abc"})
+	NewRateLimiter(stubLimiter{decision: domain.Decision{Allowed: true, Delay: time.Second}}, m).
+		Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.4"})
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`ratelimiter_decisions_total{identifier_type="token",outcome="allowed"} 1`,
+		`ratelimiter_decisions_total{identifier_type="ip",outcome="allowed"} 1`,
+		`ratelimiter_decisions_total{identifier_type="ip",outcome="denied"} 1`,
+		`ratelimiter_decisions_total{identifier_type="ip",outcome="error"} 1`,
+		`ratelimiter_decisions_total{identifier_type="ip",outcome="allowlisted"} 1`,
+		`ratelimiter_decisions_total{identifier_type="token",outcome="denylisted"} 1`,
+		`ratelimiter_decisions_total{identifier_type="ip",outcome="fail_open"} 1`,
+		`ratelimiter_decisions_total{identifier_type="token",outcome="shadow_denied"} 1`,
+		`ratelimiter_decisions_total{identifier_type="ip",outcome="delayed"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestStorage_ObservesLatencyAndBlocks(t *testing.T) {
+	m := New()
+	backend := memory.New(memory.Config{})
+	t.Cleanup(func() { _ = backend.Close() })
+
+	storage := NewStorage(backend, m)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := storage.Hit(ctx, "block", []ports.Counter{{Key: "counter", Window: time.Minute, Limit: 1}}, time.Minute, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`ratelimiter_storage_operation_duration_seconds_count{operation="hit"} 2`,
+		`ratelimiter_blocked_identifiers 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	if err := storage.SetBlock(ctx, "block", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body := scrape(t, m); !strings.Contains(body, "ratelimiter_blocked_identifiers 0") {
+		t.Fatalf("expected unblock to clear the gauge, got:\n%s", body)
+	}
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+	return string(body)
+}
+
+type stubLimiter struct {
+	decision domain.Decision
+	err      error
+}
+
+func (s stubLimiter) Allow(context.Context, domain.RateLimitRequest) (domain.Decision, error) {
+	return s.decision, s.err
+}
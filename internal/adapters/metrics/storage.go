@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+// Storage é um decorator de ports.Storage que mede a latência de cada operação e
+// acompanha os bloqueios aplicados.
+type Storage struct {
+	next    ports.Storage
+	metrics *Metrics
+}
+
+var _ ports.Storage = (*Storage)(nil)
+
+func NewStorage(next ports.Storage, metrics *Metrics) *Storage {
+	return &Storage{next: next, metrics: metrics}
+}
+
+func (s *Storage) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	defer s.metrics.observeStorage("increment", time.Now())
+	return s.next.Increment(ctx, key, window)
+}
+
+func (s *Storage) IncrementBy(ctx context.Context, key string, amount int64, window time.Duration) (int64, error) {
+	defer s.metrics.observeStorage("increment_by", time.Now())
+	return s.next.IncrementBy(ctx, key, amount, window)
+}
+
+func (s *Storage) IsBlocked(ctx context.Context, key string) (bool, error) {
+	defer s.metrics.observeStorage("is_blocked", time.Now())
+	return s.next.IsBlocked(ctx, key)
+}
+
+func (s *Storage) SetBlock(ctx context.Context, key string, duration time.Duration) error {
+	defer s.metrics.observeStorage("set_block", time.Now())
+	if err := s.next.SetBlock(ctx, key, duration); err != nil {
+		return err
+	}
+	s.metrics.blocks.set(key, duration)
+	return nil
+}
+
+func (s *Storage) TTL(ctx context.Context, key string) (time.Duration, error) {
+	defer s.metrics.observeStorage("ttl", time.Now())
+	return s.next.TTL(ctx, key)
+}
+
+func (s *Storage) Hit(ctx context.Context, blockKey string, counters []ports.Counter, block time.Duration, cost int64) (ports.HitResult, error) {
+	defer s.metrics.observeStorage("hit", time.Now())
+	result, err := s.next.Hit(ctx, blockKey, counters, block, cost)
+	if err == nil && result.Blocked {
+		s.metrics.blocks.set(blockKey, result.BlockTTL)
+	}
+	return result, err
+}
+
+func (s *Storage) TakeToken(ctx context.Context, key string, rate float64, burst int, cost int64) (ports.TokenBucketResult, error) {
+	defer s.metrics.observeStorage("take_token", time.Now())
+	return s.next.TakeToken(ctx, key, rate, burst, cost)
+}
+
+func (s *Storage) TakeSlidingLog(ctx context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	defer s.metrics.observeStorage("take_sliding_log", time.Now())
+	return s.next.TakeSlidingLog(ctx, key, window, limit, cost)
+}
+
+func (s *Storage) TakeSlidingWindow(ctx context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	defer s.metrics.observeStorage("take_sliding_window", time.Now())
+	return s.next.TakeSlidingWindow(ctx, key, window, limit, cost)
+}
+
+func (s *Storage) Get(ctx context.Context, key string) (int64, error) {
+	defer s.metrics.observeStorage("get", time.Now())
+	return s.next.Get(ctx, key)
+}
+
+func (s *Storage) Delete(ctx context.Context, keys ...string) error {
+	defer s.metrics.observeStorage("delete", time.Now())
+	if err := s.next.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		s.metrics.blocks.set(key, 0)
+	}
+	return nil
+}
+
+func (s *Storage) AcquireSlot(ctx context.Context, key, member string, limit int, lease time.Duration) (ports.SlotResult, error) {
+	defer s.metrics.observeStorage("acquire_slot", time.Now())
+	return s.next.AcquireSlot(ctx, key, member, limit, lease)
+}
+
+func (s *Storage) ReleaseSlot(ctx context.Context, key, member string) error {
+	defer s.metrics.observeStorage("release_slot", time.Now())
+	return s.next.ReleaseSlot(ctx, key, member)
+}
+
+func (s *Storage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	defer s.metrics.observeStorage("keys", time.Now())
+	return s.next.Keys(ctx, pattern)
+}
+
+func (s *Storage) CompareAndSwap(ctx context.Context, key string, old, value int64, ttl time.Duration) (bool, error) {
+	defer s.metrics.observeStorage("compare_and_swap", time.Now())
+	return s.next.CompareAndSwap(ctx, key, old, value, ttl)
+}
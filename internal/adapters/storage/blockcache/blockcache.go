@@ -0,0 +1,248 @@
+// Package blockcache disponibiliza um cache local dos bloqueios para qualquer ports.Storage.
+package blockcache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+const (
+	defaultMaxEntries = 100_000
+	resubscribeDelay  = 5 * time.Second
+)
+
+// Invalidator propaga entre as instâncias as chaves de bloqueio removidas.
+type Invalidator interface {
+	PublishInvalidation(ctx context.Context, keys ...string) error
+	// SubscribeInvalidations chama handle a cada invalidação recebida e bloqueia até ctx
+	// ser cancelado.
+	SubscribeInvalidations(ctx context.Context, handle func(keys []string)) error
+}
+
+// Storage é um decorator de ports.Storage que guarda em memória os bloqueios
+// conhecidos até a expiração deles. Enquanto um bloqueio está no cache, Hit, IsBlocked
+// e TTL respondem sem acessar o storage. Resultados negativos nunca são guardados,
+// então um bloqueio novo é sempre visto no storage.
+type Storage struct {
+	next ports.Storage
+	cfg  Config
+
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+var _ ports.Storage = (*Storage)(nil)
+
+// Config define os parâmetros do cache. Valores zerados usam os padrões.
+type Config struct {
+	// MaxEntries limita a quantidade de bloqueios guardados; cheio, o cache descarta os
+	// expirados e, se ainda faltar espaço, deixa de guardar novos bloqueios.
+	MaxEntries int
+	// Invalidator, opcional, avisa as demais instâncias quando um bloqueio é removido.
+	Invalidator Invalidator
+	// Clock permite injetar o relógio (útil em testes).
+	Clock func() time.Time
+}
+
+func New(next ports.Storage, cfg Config) *Storage {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultMaxEntries
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+	return &Storage{next: next, cfg: cfg, entries: make(map[string]time.Time)}
+}
+
+// Listen remove do cache os bloqueios invalidados por outras instâncias, refazendo a
+// inscrição quando ela falha. Bloqueia até ctx ser cancelado; sem Invalidator, retorna
+// imediatamente.
+func (s *Storage) Listen(ctx context.Context) {
+	if s.cfg.Invalidator == nil {
+		return
+	}
+	for {
+		err := s.cfg.Invalidator.SubscribeInvalidations(ctx, s.forget)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("block cache invalidation subscription failed, retrying in %s: %v", resubscribeDelay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// cached devolve o tempo restante do bloqueio guardado para key.
+func (s *Storage) cached(key string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.entries[key]
+	if !ok {
+		return 0, false
+	}
+	ttl := expiresAt.Sub(s.cfg.Clock())
+	if ttl <= 0 {
+		delete(s.entries, key)
+		return 0, false
+	}
+	return ttl, true
+}
+
+func (s *Storage) remember(key string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	now := s.cfg.Clock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[key]; !exists && len(s.entries) >= s.cfg.MaxEntries {
+		for k, expiresAt := range s.entries {
+			if !now.Before(expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		if len(s.entries) >= s.cfg.MaxEntries {
+			return
+		}
+	}
+	s.entries[key] = now.Add(ttl)
+}
+
+func (s *Storage) forget(keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+}
+
+// invalidate remove as chaves localmente e avisa as demais instâncias. Uma falha ao
+// publicar não desfaz a remoção no storage; as outras instâncias só voltam a consultar
+// o storage quando o bloqueio guardado expirar.
+func (s *Storage) invalidate(ctx context.Context, keys ...string) {
+	s.forget(keys)
+	if s.cfg.Invalidator == nil {
+		return
+	}
+	if err := s.cfg.Invalidator.PublishInvalidation(ctx, keys...); err != nil {
+		log.Printf("failed to publish block invalidation: %v", err)
+	}
+}
+
+// Hit responde a partir do cache quando o identificador está bloqueado, como o storage
+// faria: nada é incrementado. Os contadores são reportados como esgotados.
+func (s *Storage) Hit(ctx context.Context, blockKey string, counters []ports.Counter, block time.Duration, cost int64) (ports.HitResult, error) {
+	if ttl, ok := s.cached(blockKey); ok {
+		result := ports.HitResult{
+			Counts:   make([]int64, len(counters)),
+			TTLs:     make([]time.Duration, len(counters)),
+			Exceeded: -1,
+			Blocked:  true,
+			BlockTTL: ttl,
+		}
+		for i, c := range counters {
+			result.Counts[i] = int64(c.Limit)
+		}
+		return result, nil
+	}
+
+	result, err := s.next.Hit(ctx, blockKey, counters, block, cost)
+	if err == nil && result.Blocked {
+		s.remember(blockKey, result.BlockTTL)
+	}
+	return result, err
+}
+
+func (s *Storage) IsBlocked(ctx context.Context, key string) (bool, error) {
+	if _, ok := s.cached(key); ok {
+		return true, nil
+	}
+	blocked, err := s.next.IsBlocked(ctx, key)
+	if err != nil || !blocked {
+		return blocked, err
+	}
+	// A expiração é necessária para guardar o bloqueio.
+	if ttl, err := s.next.TTL(ctx, key); err == nil {
+		s.remember(key, ttl)
+	}
+	return true, nil
+}
+
+func (s *Storage) SetBlock(ctx context.Context, key string, duration time.Duration) error {
+	if err := s.next.SetBlock(ctx, key, duration); err != nil {
+		return err
+	}
+	if duration <= 0 {
+		s.invalidate(ctx, key)
+		return nil
+	}
+	s.remember(key, duration)
+	return nil
+}
+
+// TTL só usa o cache para chaves de bloqueio já conhecidas; as demais vão ao storage.
+func (s *Storage) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if ttl, ok := s.cached(key); ok {
+		return ttl, nil
+	}
+	return s.next.TTL(ctx, key)
+}
+
+func (s *Storage) Delete(ctx context.Context, keys ...string) error {
+	if err := s.next.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	s.invalidate(ctx, keys...)
+	return nil
+}
+
+func (s *Storage) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return s.next.Increment(ctx, key, window)
+}
+
+func (s *Storage) IncrementBy(ctx context.Context, key string, amount int64, window time.Duration) (int64, error) {
+	return s.next.IncrementBy(ctx, key, amount, window)
+}
+
+func (s *Storage) TakeToken(ctx context.Context, key string, rate float64, burst int, cost int64) (ports.TokenBucketResult, error) {
+	return s.next.TakeToken(ctx, key, rate, burst, cost)
+}
+
+func (s *Storage) TakeSlidingLog(ctx context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	return s.next.TakeSlidingLog(ctx, key, window, limit, cost)
+}
+
+func (s *Storage) TakeSlidingWindow(ctx context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	return s.next.TakeSlidingWindow(ctx, key, window, limit, cost)
+}
+
+func (s *Storage) Get(ctx context.Context, key string) (int64, error) {
+	return s.next.Get(ctx, key)
+}
+
+func (s *Storage) CompareAndSwap(ctx context.Context, key string, old, value int64, ttl time.Duration) (bool, error) {
+	return s.next.CompareAndSwap(ctx, key, old, value, ttl)
+}
+
+func (s *Storage) AcquireSlot(ctx context.Context, key, member string, limit int, lease time.Duration) (ports.SlotResult, error) {
+	return s.next.AcquireSlot(ctx, key, member, limit, lease)
+}
+
+func (s *Storage) ReleaseSlot(ctx context.Context, key, member string) error {
+	return s.next.ReleaseSlot(ctx, key, member)
+}
+
+func (s *Storage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return s.next.Keys(ctx, pattern)
+}
@@ -0,0 +1,160 @@
+package blockcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/memory"
+	"github.com/JeanGrijp/rate-limiter/internal/clocktest"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+func TestStorage_ServesKnownBlocksLocally(t *testing.T) {
+	clock := clocktest.New()
+	next := &countingStorage{Storage: newMemoryStorage(t, clock)}
+	storage := New(next, Config{Clock: clock.Now})
+	ctx := context.Background()
+	counters := []ports.Counter{{Key: "counter", Window: time.Minute, Limit: 1}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := storage.Hit(ctx, "block", counters, time.Minute, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if next.hits != 2 {
+		t.Fatalf("expected both hits to reach the storage, got %d", next.hits)
+	}
+
+	// The second hit blocked the identifier; further hits are answered from the cache.
+	clock.Advance(30 * time.Second)
+	result, err := storage.Hit(ctx, "block", counters, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next.hits != 2 || !result.Blocked || result.BlockTTL != 30*time.Second || result.Counts[0] != 1 {
+		t.Fatalf("expected a cached block, got hits=%d result=%+v", next.hits, result)
+	}
+	if ttl, _ := storage.TTL(ctx, "block"); ttl != 30*time.Second {
+		t.Fatalf("expected cached TTL, got %s", ttl)
+	}
+
+	// Once the block expires the storage is consulted again.
+	clock.Advance(30 * time.Second)
+	if result, _ := storage.Hit(ctx, "block", counters, time.Minute, 1); next.hits != 3 || result.Blocked {
+		t.Fatalf("expected expired block to reach the storage, got hits=%d result=%+v", next.hits, result)
+	}
+}
+
+func TestStorage_DeleteInvalidatesOtherInstances(t *testing.T) {
+	clock := clocktest.New()
+	shared := newMemoryStorage(t, clock)
+	bus := &fakeBus{}
+	first := New(shared, Config{Clock: clock.Now, Invalidator: bus})
+	second := New(shared, Config{Clock: clock.Now, Invalidator: bus})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go second.Listen(ctx)
+	bus.waitSubscribed(t)
+
+	if err := first.SetBlock(ctx, "block", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocked, _ := second.IsBlocked(ctx, "block"); !blocked {
+		t.Fatalf("expected second instance to see the block")
+	}
+
+	if err := first.Delete(ctx, "block"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, cached := second.cached("block"); !cached {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected second instance cache to be invalidated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if blocked, _ := second.IsBlocked(ctx, "block"); blocked {
+		t.Fatalf("expected block to be gone")
+	}
+}
+
+func TestStorage_RespectsMaxEntries(t *testing.T) {
+	clock := clocktest.New()
+	storage := New(newMemoryStorage(t, clock), Config{Clock: clock.Now, MaxEntries: 1})
+	ctx := context.Background()
+
+	_ = storage.SetBlock(ctx, "a", time.Second)
+	_ = storage.SetBlock(ctx, "b", time.Minute)
+	if _, cached := storage.cached("b"); cached {
+		t.Fatalf("expected full cache to skip new entries")
+	}
+
+	// Expired entries are evicted to make room.
+	clock.Advance(time.Second)
+	_ = storage.SetBlock(ctx, "c", time.Minute)
+	if _, cached := storage.cached("c"); !cached {
+		t.Fatalf("expected expired entry to be evicted")
+	}
+}
+
+func newMemoryStorage(t *testing.T, clock *clocktest.Clock) *memory.Storage {
+	t.Helper()
+	storage := memory.New(memory.Config{Clock: clock.Now})
+	t.Cleanup(func() { _ = storage.Close() })
+	return storage
+}
+
+type countingStorage struct {
+	ports.Storage
+	hits int
+}
+
+func (c *countingStorage) Hit(ctx context.Context, blockKey string, counters []ports.Counter, block time.Duration, cost int64) (ports.HitResult, error) {
+	c.hits++
+	return c.Storage.Hit(ctx, blockKey, counters, block, cost)
+}
+
+// fakeBus delivers published invalidations to every subscriber, like Redis pub/sub.
+type fakeBus struct {
+	mu          sync.Mutex
+	subscribers []func([]string)
+}
+
+func (b *fakeBus) PublishInvalidation(_ context.Context, keys ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, handle := range b.subscribers {
+		handle(keys)
+	}
+	return nil
+}
+
+func (b *fakeBus) SubscribeInvalidations(ctx context.Context, handle func([]string)) error {
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, handle)
+	b.mu.Unlock()
+	<-ctx.Done()
+	return nil
+}
+
+func (b *fakeBus) waitSubscribed(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		n := len(b.subscribers)
+		b.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscriber did not register")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,217 @@
+// Package breaker disponibiliza um circuit breaker para qualquer ports.Storage.
+package breaker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 10 * time.Second
+)
+
+// Storage é um decorator de ports.Storage que para de chamar um storage com falhas
+// consecutivas. Aberto o circuito, as chamadas vão para o Fallback ou falham com
+// ports.ErrStorageUnavailable; passado OpenDuration, uma única chamada de teste é
+// liberada e, se tiver sucesso, o circuito volta a fechar.
+type Storage struct {
+	next     ports.Storage
+	fallback ports.Storage
+	cfg      Config
+
+	mu        sync.Mutex
+	state     state
+	failures  int
+	openUntil time.Time
+}
+
+var _ ports.Storage = (*Storage)(nil)
+
+// Config define os parâmetros do circuit breaker. Valores zerados usam os padrões.
+type Config struct {
+	// FailureThreshold é a quantidade de falhas consecutivas que abre o circuito.
+	FailureThreshold int
+	// OpenDuration é quanto tempo o circuito fica aberto antes da chamada de teste.
+	OpenDuration time.Duration
+	// Fallback, opcional, atende as chamadas enquanto o circuito está aberto e as que
+	// falham no storage principal.
+	Fallback ports.Storage
+	// Clock permite injetar o relógio (útil em testes).
+	Clock func() time.Time
+}
+
+type state int
+
+const (
+	stateClosed state = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func New(next ports.Storage, cfg Config) *Storage {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = defaultOpenDuration
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+	return &Storage{next: next, fallback: cfg.Fallback, cfg: cfg}
+}
+
+// call executa op no storage principal quando o circuito permite e registra o
+// resultado. Falhas causadas pelo cancelamento do contexto do chamador não contam.
+func call[T any](s *Storage, ctx context.Context, op func(ports.Storage) (T, error)) (T, error) {
+	if !s.acquire() {
+		if s.fallback != nil {
+			return op(s.fallback)
+		}
+		var zero T
+		return zero, ports.ErrStorageUnavailable
+	}
+
+	result, err := op(s.next)
+	if err != nil && ctx.Err() != nil {
+		s.release()
+		return result, err
+	}
+	s.record(err)
+	if err != nil && s.fallback != nil {
+		return op(s.fallback)
+	}
+	return result, err
+}
+
+// acquire indica se a chamada pode ir ao storage principal. No estado semiaberto só a
+// chamada de teste passa.
+func (s *Storage) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case stateOpen:
+		if s.cfg.Clock().Before(s.openUntil) {
+			return false
+		}
+		s.state = stateHalfOpen
+		return true
+	case stateHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// release devolve o estado semiaberto para aberto quando a chamada de teste não chegou
+// a um resultado, para que a próxima chamada faça o teste.
+func (s *Storage) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == stateHalfOpen {
+		s.state = stateOpen
+	}
+}
+
+func (s *Storage) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		if s.state == stateHalfOpen {
+			log.Printf("storage recovered, closing circuit breaker")
+		}
+		s.state = stateClosed
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if s.state == stateHalfOpen || s.failures >= s.cfg.FailureThreshold {
+		if s.state != stateOpen {
+			log.Printf("storage failing, opening circuit breaker for %s: %v", s.cfg.OpenDuration, err)
+		}
+		s.state = stateOpen
+		s.openUntil = s.cfg.Clock().Add(s.cfg.OpenDuration)
+	}
+}
+
+func (s *Storage) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return call(s, ctx, func(st ports.Storage) (int64, error) { return st.Increment(ctx, key, window) })
+}
+
+func (s *Storage) IncrementBy(ctx context.Context, key string, amount int64, window time.Duration) (int64, error) {
+	return call(s, ctx, func(st ports.Storage) (int64, error) { return st.IncrementBy(ctx, key, amount, window) })
+}
+
+func (s *Storage) IsBlocked(ctx context.Context, key string) (bool, error) {
+	return call(s, ctx, func(st ports.Storage) (bool, error) { return st.IsBlocked(ctx, key) })
+}
+
+func (s *Storage) SetBlock(ctx context.Context, key string, duration time.Duration) error {
+	_, err := call(s, ctx, func(st ports.Storage) (struct{}, error) { return struct{}{}, st.SetBlock(ctx, key, duration) })
+	return err
+}
+
+func (s *Storage) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return call(s, ctx, func(st ports.Storage) (time.Duration, error) { return st.TTL(ctx, key) })
+}
+
+func (s *Storage) Hit(ctx context.Context, blockKey string, counters []ports.Counter, block time.Duration, cost int64) (ports.HitResult, error) {
+	return call(s, ctx, func(st ports.Storage) (ports.HitResult, error) {
+		return st.Hit(ctx, blockKey, counters, block, cost)
+	})
+}
+
+func (s *Storage) TakeToken(ctx context.Context, key string, rate float64, burst int, cost int64) (ports.TokenBucketResult, error) {
+	return call(s, ctx, func(st ports.Storage) (ports.TokenBucketResult, error) {
+		return st.TakeToken(ctx, key, rate, burst, cost)
+	})
+}
+
+func (s *Storage) TakeSlidingLog(ctx context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	return call(s, ctx, func(st ports.Storage) (ports.SlidingWindowResult, error) {
+		return st.TakeSlidingLog(ctx, key, window, limit, cost)
+	})
+}
+
+func (s *Storage) TakeSlidingWindow(ctx context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	return call(s, ctx, func(st ports.Storage) (ports.SlidingWindowResult, error) {
+		return st.TakeSlidingWindow(ctx, key, window, limit, cost)
+	})
+}
+
+func (s *Storage) Get(ctx context.Context, key string) (int64, error) {
+	return call(s, ctx, func(st ports.Storage) (int64, error) { return st.Get(ctx, key) })
+}
+
+func (s *Storage) CompareAndSwap(ctx context.Context, key string, old, value int64, ttl time.Duration) (bool, error) {
+	return call(s, ctx, func(st ports.Storage) (bool, error) { return st.CompareAndSwap(ctx, key, old, value, ttl) })
+}
+
+func (s *Storage) Delete(ctx context.Context, keys ...string) error {
+	_, err := call(s, ctx, func(st ports.Storage) (struct{}, error) { return struct{}{}, st.Delete(ctx, keys...) })
+	return err
+}
+
+func (s *Storage) AcquireSlot(ctx context.Context, key, member string, limit int, lease time.Duration) (ports.SlotResult, error) {
+	return call(s, ctx, func(st ports.Storage) (ports.SlotResult, error) {
+		return st.AcquireSlot(ctx, key, member, limit, lease)
+	})
+}
+
+func (s *Storage) ReleaseSlot(ctx context.Context, key, member string) error {
+	_, err := call(s, ctx, func(st ports.Storage) (struct{}, error) { return struct{}{}, st.ReleaseSlot(ctx, key, member) })
+	return err
+}
+
+func (s *Storage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return call(s, ctx, func(st ports.Storage) ([]string, error) { return st.Keys(ctx, pattern) })
+}
@@ -0,0 +1,123 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/memory"
+	"github.com/JeanGrijp/rate-limiter/internal/clocktest"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+func TestStorage_OpensAfterConsecutiveFailuresAndRecovers(t *testing.T) {
+	clock := clocktest.New()
+	next := &flakyStorage{Storage: memory.New(memory.Config{}), err: errors.New("connection refused")}
+	storage := New(next, Config{FailureThreshold: 2, OpenDuration: time.Second, Clock: clock.Now})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := storage.Increment(ctx, "k", time.Minute); err == nil || errors.Is(err, ports.ErrStorageUnavailable) {
+			t.Fatalf("expected the storage error while closed, got %v", err)
+		}
+	}
+
+	// Open: calls fail fast without reaching the storage.
+	if _, err := storage.Increment(ctx, "k", time.Minute); !errors.Is(err, ports.ErrStorageUnavailable) {
+		t.Fatalf("expected ErrStorageUnavailable, got %v", err)
+	}
+	if next.calls != 2 {
+		t.Fatalf("expected open circuit to skip the storage, got %d calls", next.calls)
+	}
+
+	// A failed probe reopens the circuit.
+	clock.Advance(time.Second)
+	if _, err := storage.Increment(ctx, "k", time.Minute); errors.Is(err, ports.ErrStorageUnavailable) {
+		t.Fatalf("expected the probe to reach the storage, got %v", err)
+	}
+	if _, err := storage.Increment(ctx, "k", time.Minute); !errors.Is(err, ports.ErrStorageUnavailable) {
+		t.Fatalf("expected circuit to reopen after a failed probe, got %v", err)
+	}
+
+	// A successful probe closes it.
+	next.setErr(nil)
+	clock.Advance(time.Second)
+	for i := 0; i < 3; i++ {
+		if _, err := storage.Increment(ctx, "k", time.Minute); err != nil {
+			t.Fatalf("expected circuit to close after recovery, got %v", err)
+		}
+	}
+}
+
+func TestStorage_UsesFallbackWhileFailing(t *testing.T) {
+	next := &flakyStorage{Storage: memory.New(memory.Config{}), err: errors.New("connection refused")}
+	fallback := memory.New(memory.Config{})
+	storage := New(next, Config{FailureThreshold: 1, OpenDuration: time.Minute, Fallback: fallback})
+	ctx := context.Background()
+
+	// The failing call and the ones made while open are both served by the fallback.
+	for i := int64(1); i <= 3; i++ {
+		count, err := storage.Increment(ctx, "k", time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if count != i {
+			t.Fatalf("expected fallback count %d, got %d", i, count)
+		}
+	}
+	if next.calls != 1 {
+		t.Fatalf("expected a single call to the failing storage, got %d", next.calls)
+	}
+}
+
+func TestStorage_IgnoresCallerCancellation(t *testing.T) {
+	next := &flakyStorage{Storage: memory.New(memory.Config{}), err: context.Canceled}
+	storage := New(next, Config{FailureThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _ = storage.Get(ctx, "k")
+
+	next.setErr(nil)
+	if _, err := storage.Get(context.Background(), "k"); err != nil {
+		t.Fatalf("expected cancellation not to open the circuit, got %v", err)
+	}
+}
+
+// flakyStorage fails every call with err while it is set.
+type flakyStorage struct {
+	ports.Storage
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (f *flakyStorage) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *flakyStorage) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	f.mu.Lock()
+	f.calls++
+	err := f.err
+	f.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return f.Storage.Increment(ctx, key, window)
+}
+
+func (f *flakyStorage) Get(ctx context.Context, key string) (int64, error) {
+	f.mu.Lock()
+	err := f.err
+	f.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return f.Storage.Get(ctx, key)
+}
@@ -0,0 +1,580 @@
+// Package memory disponibiliza uma implementação do storage mantida em memória do processo.
+package memory
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+const (
+	defaultShards          = 64
+	defaultCleanupInterval = time.Minute
+)
+
+// Storage mantém contadores e bloqueios em memória, distribuídos em shards
+// independentes para reduzir a contenção de locks sob alta concorrência.
+type Storage struct {
+	shards []*shard
+	now    func() time.Time
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ ports.Storage = (*Storage)(nil)
+
+// Config define os parâmetros do storage em memória. Valores zerados usam os padrões.
+type Config struct {
+	Shards          int
+	CleanupInterval time.Duration
+	// Clock permite injetar o relógio utilizado para expiração (útil em testes).
+	Clock func() time.Time
+}
+
+type shard struct {
+	mu    sync.Mutex
+	index int
+	items map[string]item
+}
+
+type item struct {
+	value     int64
+	expiresAt time.Time
+
+	// Estado de token bucket.
+	tokens    float64
+	updatedAt time.Time
+
+	// Estado das janelas deslizantes.
+	prev        int64
+	windowStart time.Time
+	log         []time.Time
+
+	// Vagas de concorrência e o fim da concessão de cada uma.
+	slots map[string]time.Time
+}
+
+func (i item) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !now.Before(i.expiresAt)
+}
+
+// ttl devolve o tempo restante até a expiração, ou 0 quando o item não expira.
+func (i item) ttl(now time.Time) time.Duration {
+	if i.expiresAt.IsZero() {
+		return 0
+	}
+	return max(i.expiresAt.Sub(now), 0)
+}
+
+// New cria o storage e inicia a rotina de limpeza das chaves expiradas.
+func New(cfg Config) *Storage {
+	if cfg.Shards <= 0 {
+		cfg.Shards = defaultShards
+	}
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = defaultCleanupInterval
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+
+	s := &Storage{
+		shards: make([]*shard, cfg.Shards),
+		now:    cfg.Clock,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for i := range s.shards {
+		s.shards[i] = &shard{index: i, items: make(map[string]item)}
+	}
+
+	go s.janitor(cfg.CleanupInterval)
+
+	return s
+}
+
+// Close interrompe a rotina de limpeza. O storage continua utilizável, mas
+// chaves expiradas passam a ser removidas apenas quando acessadas.
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return nil
+}
+
+func (s *Storage) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return s.IncrementBy(ctx, key, 1, window)
+}
+
+func (s *Storage) IncrementBy(_ context.Context, key string, amount int64, window time.Duration) (int64, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	it, ok := sh.items[key]
+	if !ok || it.expired(now) {
+		it = item{}
+		if window > 0 {
+			it.expiresAt = now.Add(window)
+		}
+	}
+	it.value += amount
+	sh.items[key] = it
+
+	return it.value, nil
+}
+
+func (s *Storage) IsBlocked(_ context.Context, key string) (bool, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	it, ok := sh.items[key]
+	if !ok {
+		return false, nil
+	}
+	if it.expired(now) {
+		delete(sh.items, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *Storage) SetBlock(_ context.Context, key string, duration time.Duration) error {
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if duration <= 0 {
+		delete(sh.items, key)
+		return nil
+	}
+	sh.items[key] = item{value: 1, expiresAt: s.now().Add(duration)}
+	return nil
+}
+
+func (s *Storage) TTL(_ context.Context, key string) (time.Duration, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	it, ok := sh.items[key]
+	if !ok || it.expired(now) {
+		return 0, nil
+	}
+	if it.expiresAt.IsZero() {
+		return -1, nil
+	}
+	return it.ttl(now), nil
+}
+
+func (s *Storage) Hit(_ context.Context, blockKey string, counters []ports.Counter, block time.Duration, cost int64) (ports.HitResult, error) {
+	now := s.now()
+	blockShard := s.shardFor(blockKey)
+	shards := make([]*shard, len(counters))
+	involved := []*shard{blockShard}
+	for i, c := range counters {
+		shards[i] = s.shardFor(c.Key)
+		involved = append(involved, shards[i])
+	}
+	unlock := lockShards(involved...)
+	defer unlock()
+
+	items := make([]item, len(counters))
+	result := ports.HitResult{
+		Counts:   make([]int64, len(counters)),
+		TTLs:     make([]time.Duration, len(counters)),
+		Exceeded: -1,
+	}
+	for i, c := range counters {
+		it, ok := shards[i].items[c.Key]
+		if !ok || it.expired(now) {
+			it = item{}
+		}
+		items[i] = it
+		if result.Exceeded < 0 && it.value+cost > int64(c.Limit) {
+			result.Exceeded = i
+		}
+	}
+
+	fill := func() {
+		for i := range items {
+			result.Counts[i] = items[i].value
+			result.TTLs[i] = items[i].ttl(now)
+		}
+	}
+
+	if blocked, ok := blockShard.items[blockKey]; ok && !blocked.expired(now) {
+		fill()
+		result.Exceeded = -1
+		result.Blocked = true
+		result.BlockTTL = blocked.ttl(now)
+		return result, nil
+	}
+
+	if result.Exceeded >= 0 {
+		fill()
+		if block > 0 {
+			blockShard.items[blockKey] = item{value: 1, expiresAt: now.Add(block)}
+			result.Blocked = true
+			result.BlockTTL = block
+		}
+		return result, nil
+	}
+
+	for i, c := range counters {
+		if items[i].value == 0 && c.Window > 0 {
+			items[i].expiresAt = now.Add(c.Window)
+		}
+		items[i].value += cost
+		shards[i].items[c.Key] = items[i]
+	}
+	fill()
+	return result, nil
+}
+
+func (s *Storage) TakeToken(_ context.Context, key string, rate float64, burst int, cost int64) (ports.TokenBucketResult, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	capacity := float64(burst)
+	it, ok := sh.items[key]
+	if !ok || it.expired(now) {
+		it = item{tokens: capacity, updatedAt: now}
+	}
+
+	if elapsed := now.Sub(it.updatedAt); elapsed > 0 {
+		it.tokens = math.Min(capacity, it.tokens+elapsed.Seconds()*rate)
+	}
+	it.updatedAt = now
+
+	result := ports.TokenBucketResult{}
+	if need := float64(cost); it.tokens >= need {
+		it.tokens -= need
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((need - it.tokens) / rate)
+	}
+	result.Tokens = it.tokens
+
+	// O bucket cheio equivale a uma chave inexistente, então ela pode expirar nesse ponto.
+	it.expiresAt = now.Add(secondsToDuration((capacity-it.tokens)/rate) + time.Millisecond)
+	sh.items[key] = it
+
+	return result, nil
+}
+
+func (s *Storage) TakeSlidingLog(_ context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	it, ok := sh.items[key]
+	if !ok || it.expired(now) {
+		it = item{}
+	}
+
+	cutoff := now.Add(-window)
+	stale := 0
+	for stale < len(it.log) && !it.log[stale].After(cutoff) {
+		stale++
+	}
+	it.log = it.log[stale:]
+
+	result := ports.SlidingWindowResult{}
+	if int64(len(it.log))+cost <= int64(limit) {
+		for i := int64(0); i < cost; i++ {
+			it.log = append(it.log, now)
+		}
+		it.expiresAt = now.Add(window)
+		result.Allowed = true
+	} else if len(it.log) > 0 {
+		// Espera sair da janela o registro que libera espaço para cost novas entradas.
+		index := min(int64(len(it.log))+cost-int64(limit)-1, int64(len(it.log)-1))
+		result.RetryAfter = it.log[index].Add(window).Sub(now)
+	} else {
+		result.RetryAfter = window
+	}
+	result.Count = int64(len(it.log))
+	if len(it.log) > 0 {
+		result.ResetAfter = it.log[len(it.log)-1].Add(window).Sub(now)
+	}
+	sh.items[key] = it
+
+	return result, nil
+}
+
+func (s *Storage) TakeSlidingWindow(_ context.Context, key string, window time.Duration, limit int, cost int64) (ports.SlidingWindowResult, error) {
+	now := s.now()
+	start := time.Unix(0, now.UnixNano()-now.UnixNano()%int64(window))
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	it, ok := sh.items[key]
+	if !ok || it.expired(now) {
+		it = item{windowStart: start}
+	}
+
+	switch {
+	case it.windowStart.Equal(start):
+	case it.windowStart.Equal(start.Add(-window)):
+		it.prev, it.value = it.value, 0
+	default:
+		it.prev, it.value = 0, 0
+	}
+	it.windowStart = start
+	it.expiresAt = start.Add(2 * window)
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(it.prev)*weight + float64(it.value)
+
+	result := ports.SlidingWindowResult{}
+	if estimate+float64(cost) <= float64(limit) {
+		it.value += cost
+		estimate += float64(cost)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = slidingWindowRetryAfter(it.prev, it.value, cost, limit, elapsed, window)
+	}
+	result.Count = int64(estimate)
+	switch {
+	case it.value > 0:
+		result.ResetAfter = 2*window - elapsed
+	case it.prev > 0:
+		result.ResetAfter = window - elapsed
+	}
+	sh.items[key] = it
+
+	return result, nil
+}
+
+func (s *Storage) Get(_ context.Context, key string) (int64, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	it, ok := sh.items[key]
+	if !ok || it.expired(now) {
+		return 0, nil
+	}
+	return it.value, nil
+}
+
+func (s *Storage) CompareAndSwap(_ context.Context, key string, old, value int64, ttl time.Duration) (bool, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	var current int64
+	if it, ok := sh.items[key]; ok && !it.expired(now) {
+		current = it.value
+	}
+	if current != old {
+		return false, nil
+	}
+
+	it := item{value: value}
+	if ttl > 0 {
+		it.expiresAt = now.Add(ttl)
+	}
+	sh.items[key] = it
+	return true, nil
+}
+
+func (s *Storage) AcquireSlot(_ context.Context, key, member string, limit int, lease time.Duration) (ports.SlotResult, error) {
+	now := s.now()
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	it, ok := sh.items[key]
+	if !ok || it.expired(now) {
+		it = item{}
+	}
+	for id, until := range it.slots {
+		if !now.Before(until) {
+			delete(it.slots, id)
+		}
+	}
+
+	if len(it.slots) >= limit {
+		sh.items[key] = it
+		return ports.SlotResult{InUse: int64(len(it.slots))}, nil
+	}
+
+	if it.slots == nil {
+		it.slots = make(map[string]time.Time)
+	}
+	until := now.Add(lease)
+	it.slots[member] = until
+	// O item vive até o fim da concessão mais longa.
+	if until.After(it.expiresAt) {
+		it.expiresAt = until
+	}
+	sh.items[key] = it
+	return ports.SlotResult{Acquired: true, InUse: int64(len(it.slots))}, nil
+}
+
+func (s *Storage) ReleaseSlot(_ context.Context, key, member string) error {
+	sh := s.shardFor(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if it, ok := sh.items[key]; ok {
+		delete(it.slots, member)
+	}
+	return nil
+}
+
+func (s *Storage) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		sh := s.shardFor(key)
+		sh.mu.Lock()
+		delete(sh.items, key)
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *Storage) Keys(_ context.Context, pattern string) ([]string, error) {
+	now := s.now()
+	var keys []string
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, it := range sh.items {
+			if !it.expired(now) && matchPattern(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+		sh.mu.Unlock()
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// matchPattern compara key com um padrão em que "*" representa qualquer sequência,
+// o subconjunto do glob do Redis usado pelas operações administrativas.
+func matchPattern(pattern, key string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == key
+	}
+	if !strings.HasPrefix(key, parts[0]) {
+		return false
+	}
+	key = key[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(key, part)
+		if i < 0 {
+			return false
+		}
+		key = key[i+len(part):]
+	}
+	return len(key) >= len(last) && strings.HasSuffix(key, last)
+}
+
+// slidingWindowRetryAfter calcula quanto falta para que prev*peso + atual + cost caiba no limite.
+func slidingWindowRetryAfter(prev, curr, cost int64, limit int, elapsed, window time.Duration) time.Duration {
+	w := float64(window)
+	var wait float64
+	if curr+cost <= int64(limit) {
+		// Basta o peso da janela anterior decair o suficiente ainda na janela atual.
+		wait = (1-float64(int64(limit)-curr-cost)/float64(prev))*w - float64(elapsed)
+	} else {
+		// Só na próxima janela, quando o contador atual passa a ser o anterior.
+		wait = w - float64(elapsed) + math.Max(0, 1-float64(int64(limit)-cost)/float64(max(curr, 1)))*w
+	}
+	return time.Duration(math.Ceil(math.Max(wait, 0)))
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+func (s *Storage) shardFor(key string) *shard {
+	// FNV-1a inline para evitar alocações no caminho quente.
+	var h uint32 = 2166136261
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+// lockShards trava os shards envolvidos sempre na mesma ordem (e cada um uma única
+// vez) para evitar deadlocks entre operações que envolvem mais de uma chave.
+func lockShards(shards ...*shard) func() {
+	sort.Slice(shards, func(i, j int) bool { return shards[i].index < shards[j].index })
+	locked := shards[:0]
+	for _, sh := range shards {
+		if len(locked) > 0 && locked[len(locked)-1] == sh {
+			continue
+		}
+		sh.mu.Lock()
+		locked = append(locked, sh)
+	}
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].mu.Unlock()
+		}
+	}
+}
+
+func (s *Storage) janitor(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.evictExpired()
+		}
+	}
+}
+
+func (s *Storage) evictExpired() {
+	now := s.now()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, it := range sh.items {
+			if it.expired(now) {
+				delete(sh.items, key)
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/storagetest"
+	"github.com/JeanGrijp/rate-limiter/internal/clocktest"
+)
+
+func TestStorage_Contract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Harness {
+		clock := clocktest.New()
+		return storagetest.Harness{Storage: newTestStorage(t, clock), Advance: clock.Advance}
+	})
+}
+
+func TestStorage_EvictExpiredRemovesStaleKeys(t *testing.T) {
+	clock := clocktest.New()
+	storage := newTestStorage(t, clock)
+	ctx := context.Background()
+
+	_, _ = storage.Increment(ctx, "short", time.Second)
+	_, _ = storage.Increment(ctx, "long", time.Hour)
+
+	clock.Advance(time.Minute)
+	storage.evictExpired()
+
+	if _, ok := storage.shardFor("short").items["short"]; ok {
+		t.Fatalf("expected expired key to be evicted")
+	}
+	if _, ok := storage.shardFor("long").items["long"]; !ok {
+		t.Fatalf("expected live key to be kept")
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"a*c", "abc", true},
+		{"a*c", "ac", true},
+		{"a*c", "abd", false},
+		{"*:block", "x:block", true},
+		{"a*b*c", "abbc", true},
+		{"a*a", "a", false},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+	}
+
+	for _, tc := range tests {
+		if got := matchPattern(tc.pattern, tc.key); got != tc.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tc.pattern, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestStorage_ConcurrentIncrements(t *testing.T) {
+	storage := newTestStorage(t, nil)
+	ctx := context.Background()
+
+	const workers, perWorker = 32, 500
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := storage.Increment(ctx, "shared", time.Minute); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, _ := storage.Increment(ctx, "shared", time.Minute)
+	if count != workers*perWorker+1 {
+		t.Fatalf("expected %d increments, got %d", workers*perWorker+1, count)
+	}
+}
+
+func newTestStorage(t *testing.T, clock *clocktest.Clock) *Storage {
+	t.Helper()
+	cfg := Config{Shards: 8, CleanupInterval: time.Hour}
+	if clock != nil {
+		cfg.Clock = clock.Now
+	}
+	storage := New(cfg)
+	t.Cleanup(func() { _ = storage.Close() })
+	return storage
+}
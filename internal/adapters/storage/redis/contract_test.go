@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/storagetest"
+	"github.com/JeanGrijp/rate-limiter/internal/clocktest"
+)
+
+func TestStorage_Contract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Harness {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{
+			Addr: server.Addr(),
+			// miniredis doesn't know CLIENT MAINT_NOTIFICATIONS.
+			MaintNotificationsConfig: &maintnotifications.Config{Mode: maintnotifications.ModeDisabled},
+		})
+		t.Cleanup(func() { _ = client.Close() })
+
+		// TIME, used by the scripts, and key expiry advance together.
+		now := clocktest.Start
+		server.SetTime(now)
+		return storagetest.Harness{
+			Storage: &Storage{client: client},
+			Advance: func(d time.Duration) {
+				now = now.Add(d)
+				server.SetTime(now)
+				server.FastForward(d)
+			},
+		}
+	})
+}
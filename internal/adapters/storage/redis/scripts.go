@@ -0,0 +1,271 @@
+package redis
+
+import redis "github.com/redis/go-redis/v9"
+
+// incrementScript soma o valor ao contador e define a expiração apenas quando a janela
+// começa, para que incrementos posteriores não a estendam.
+//
+// KEYS[1] = contador
+// ARGV[1] = janela em milissegundos (0 mantém o contador sem expiração)
+// ARGV[2] = valor a somar
+//
+// Retorna o novo valor do contador.
+var incrementScript = redis.NewScript(`
+local amount = tonumber(ARGV[2])
+local count = redis.call('INCRBY', KEYS[1], amount)
+local window = tonumber(ARGV[1])
+if window > 0 and (count == amount or redis.call('PTTL', KEYS[1]) < 0) then
+	redis.call('PEXPIRE', KEYS[1], window)
+end
+return count
+`)
+
+// hitScript verifica o bloqueio, avalia todos os contadores e os incrementa (ou
+// aplica o bloqueio) em uma única ida ao Redis.
+//
+// KEYS[1]   = chave de bloqueio
+// KEYS[2..] = contadores
+// ARGV[1]   = duração do bloqueio em milissegundos (0 desativa o bloqueio)
+// ARGV[2]   = custo da requisição
+// ARGV[3..] = pares {janela em milissegundos, limite}, na ordem dos contadores
+//
+// Retorna {bloqueado (0/1), ttl do bloqueio em ms, índice do contador excedido (-1
+// quando nenhum), seguido de {contagem, ttl em ms} de cada contador}.
+var hitScript = redis.NewScript(`
+local counters = #KEYS - 1
+local cost = tonumber(ARGV[2])
+local counts = {}
+local exceeded = -1
+for i = 1, counters do
+	counts[i] = tonumber(redis.call('GET', KEYS[i + 1])) or 0
+	if exceeded == -1 and counts[i] + cost > tonumber(ARGV[2 * i + 2]) then
+		exceeded = i - 1
+	end
+end
+
+local function reply(blocked, block_ttl, index)
+	local result = {blocked, block_ttl, index}
+	for i = 1, counters do
+		table.insert(result, counts[i])
+		table.insert(result, math.max(redis.call('PTTL', KEYS[i + 1]), 0))
+	end
+	return result
+end
+
+local block_ttl = redis.call('PTTL', KEYS[1])
+if block_ttl ~= -2 then
+	return reply(1, math.max(block_ttl, 0), -1)
+end
+
+local block = tonumber(ARGV[1])
+if exceeded ~= -1 then
+	if block > 0 then
+		redis.call('SET', KEYS[1], '1', 'PX', block)
+		return reply(1, block, exceeded)
+	end
+	return reply(0, 0, exceeded)
+end
+
+for i = 1, counters do
+	counts[i] = redis.call('INCRBY', KEYS[i + 1], cost)
+	if counts[i] == cost or redis.call('PTTL', KEYS[i + 1]) < 0 then
+		redis.call('PEXPIRE', KEYS[i + 1], ARGV[2 * i + 1])
+	end
+end
+return reply(0, 0, -1)
+`)
+
+// tokenBucketScript repõe e consome o bucket em uma única operação atômica.
+// O tempo vem do próprio Redis (TIME) para que todas as instâncias usem o mesmo relógio.
+//
+// KEYS[1] = chave do bucket
+// ARGV[1] = tokens repostos por segundo
+// ARGV[2] = capacidade do bucket
+// ARGV[3] = tokens consumidos pela requisição
+//
+// Retorna {permitido (0/1), tokens restantes (string), retry_after em microssegundos}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+local elapsed = math.max(0, now - ts)
+tokens = math.min(burst, tokens + (elapsed * rate / 1000000))
+
+local allowed = 0
+local retry_after = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+else
+	retry_after = math.ceil((cost - tokens) * 1000000 / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', string.format('%.0f', now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1)
+
+return {allowed, tostring(tokens), retry_after}
+`)
+
+// slidingLogScript mantém um sorted set com o instante (em microssegundos) de cada
+// requisição aceita dentro da janela.
+//
+// KEYS[1] = chave do log
+// ARGV[1] = janela em microssegundos
+// ARGV[2] = limite de requisições
+// ARGV[3] = prefixo único dos membros que representam a requisição
+// ARGV[4] = custo da requisição (quantidade de membros registrados)
+//
+// Retorna {permitido (0/1), contagem, retry_after e reset_after em microssegundos}.
+var slidingLogScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local cost = tonumber(ARGV[4])
+
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+
+local count = redis.call('ZCARD', KEYS[1])
+if count + cost <= limit then
+	for i = 1, cost do
+		redis.call('ZADD', KEYS[1], now, ARGV[3] .. ':' .. i)
+	end
+	redis.call('PEXPIRE', KEYS[1], math.ceil(window / 1000))
+	return {1, count + cost, 0, window}
+end
+
+if count == 0 then
+	return {0, 0, window, 0}
+end
+
+-- Espera sair da janela o registro que libera espaço para cost novas entradas.
+local index = math.min(count + cost - limit - 1, count - 1)
+local blocking = redis.call('ZRANGE', KEYS[1], index, index, 'WITHSCORES')
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+local retry_after = math.max(0, tonumber(blocking[2]) + window - now)
+local reset_after = math.max(0, tonumber(newest[2]) + window - now)
+return {0, count, retry_after, reset_after}
+`)
+
+// slidingWindowScript guarda em um hash o início da janela atual e os contadores
+// da janela atual e da anterior, estimando a contagem deslizante entre elas.
+//
+// KEYS[1] = chave do hash
+// ARGV[1] = janela em microssegundos
+// ARGV[2] = limite de requisições
+// ARGV[3] = custo da requisição
+//
+// Retorna {permitido (0/1), contagem estimada, retry_after e reset_after em microssegundos}.
+var slidingWindowScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+local start = now - (now % window)
+
+local state = redis.call('HMGET', KEYS[1], 'start', 'curr', 'prev')
+local stored_start = tonumber(state[1])
+local curr = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+
+if stored_start == nil or stored_start < start - window then
+	curr = 0
+	prev = 0
+elseif stored_start < start then
+	prev = curr
+	curr = 0
+end
+
+local elapsed = now - start
+local estimate = prev * (1 - elapsed / window) + curr
+
+local allowed = 0
+local retry_after = 0
+if estimate + cost <= limit then
+	curr = curr + cost
+	estimate = estimate + cost
+	allowed = 1
+elseif curr + cost <= limit then
+	retry_after = (1 - (limit - curr - cost) / prev) * window - elapsed
+else
+	retry_after = window - elapsed + math.max(0, 1 - (limit - cost) / math.max(curr, 1)) * window
+end
+
+redis.call('HSET', KEYS[1], 'start', string.format('%.0f', start), 'curr', curr, 'prev', prev)
+redis.call('PEXPIRE', KEYS[1], math.ceil(2 * window / 1000))
+
+local reset_after = 0
+if curr > 0 then
+	reset_after = 2 * window - elapsed
+elseif prev > 0 then
+	reset_after = window - elapsed
+end
+
+return {allowed, math.floor(estimate), math.ceil(math.max(0, retry_after)), reset_after}
+`)
+
+// acquireSlotScript mantém em um sorted set as vagas de concorrência ocupadas, com o
+// fim da concessão (em milissegundos) como score.
+//
+// KEYS[1] = chave do conjunto de vagas
+// ARGV[1] = limite de vagas
+// ARGV[2] = duração da concessão em milissegundos
+// ARGV[3] = identificador da vaga
+//
+// Retorna {ocupada (0/1), vagas em uso}.
+var acquireSlotScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local lease = tonumber(ARGV[2])
+
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+
+local count = redis.call('ZCARD', KEYS[1])
+if count >= limit then
+	return {0, count}
+end
+
+redis.call('ZADD', KEYS[1], now + lease, ARGV[3])
+-- A chave vive até o fim da concessão mais longa.
+if redis.call('PTTL', KEYS[1]) < lease then
+	redis.call('PEXPIRE', KEYS[1], lease)
+end
+return {1, count + 1}
+`)
+
+// compareAndSwapScript grava o novo valor apenas se o atual corresponder ao esperado.
+//
+// KEYS[1] = chave
+// ARGV[1] = valor esperado ("0" exige que a chave não exista)
+// ARGV[2] = novo valor
+// ARGV[3] = ttl em milissegundos
+//
+// Retorna 1 quando o valor foi gravado e 0 caso contrário.
+var compareAndSwapScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current == false then
+	current = '0'
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
@@ -0,0 +1,428 @@
+// Package storagetest reúne os casos que toda implementação de ports.Storage deve
+// satisfazer, para que os adapters de memória e Redis se comportem da mesma forma.
+package storagetest
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+// Harness é um storage vazio acompanhado do controle do seu relógio.
+type Harness struct {
+	Storage ports.Storage
+	// Advance avança o relógio do storage, inclusive o usado para expirar chaves.
+	Advance func(time.Duration)
+}
+
+// Run executa todos os casos do contrato, criando um Harness novo para cada um.
+func Run(t *testing.T, newHarness func(t *testing.T) Harness) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, h Harness)
+	}{
+		{"IncrementAnchorsWindowOnFirstHit", testIncrementAnchorsWindowOnFirstHit},
+		{"IncrementByAddsAmount", testIncrementByAddsAmount},
+		{"BlockExpires", testBlockExpires},
+		{"SetBlockWithZeroDurationUnblocks", testSetBlockWithZeroDurationUnblocks},
+		{"TTLReportsMissingKeys", testTTLReportsMissingKeys},
+		{"KeysMatchesPatternAndDeleteRemoves", testKeysMatchesPatternAndDeleteRemoves},
+		{"TakeTokenRefillsOverTime", testTakeTokenRefillsOverTime},
+		{"TakeTokenChargesCost", testTakeTokenChargesCost},
+		{"TakeSlidingLogFreesOldestEntry", testTakeSlidingLogFreesOldestEntry},
+		{"TakeSlidingWindowWeightsPreviousWindow", testTakeSlidingWindowWeightsPreviousWindow},
+		{"TakeSlidingChargesCost", testTakeSlidingChargesCost},
+		{"CompareAndSwapRequiresExpectedValue", testCompareAndSwapRequiresExpectedValue},
+		{"HitBlocksAtomically", testHitBlocksAtomically},
+		{"HitCountsTiersAllOrNothing", testHitCountsTiersAllOrNothing},
+		{"HitChargesCost", testHitChargesCost},
+		{"SlotsAreReleasedOrExpire", testSlotsAreReleasedOrExpire},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newHarness(t))
+		})
+	}
+}
+
+func testIncrementAnchorsWindowOnFirstHit(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := h.Storage.Increment(ctx, "counter", time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if count != i {
+			t.Fatalf("expected count %d, got %d", i, count)
+		}
+		// Later increments must not push the end of the window forward.
+		h.Advance(400 * time.Millisecond)
+	}
+
+	count, err := h.Storage.Increment(ctx, "counter", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected counter to restart after the window, got %d", count)
+	}
+	if ttl, _ := h.Storage.TTL(ctx, "counter"); ttl != time.Second {
+		t.Fatalf("expected a fresh window of 1s, got %v", ttl)
+	}
+}
+
+func testIncrementByAddsAmount(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	if count, err := h.Storage.IncrementBy(ctx, "counter", 5, time.Second); err != nil || count != 5 {
+		t.Fatalf("expected 5, got %d (err=%v)", count, err)
+	}
+	h.Advance(600 * time.Millisecond)
+	if count, _ := h.Storage.IncrementBy(ctx, "counter", 3, time.Second); count != 8 {
+		t.Fatalf("expected 8, got %d", count)
+	}
+	if ttl, _ := h.Storage.TTL(ctx, "counter"); ttl != 400*time.Millisecond {
+		t.Fatalf("expected the window to keep its first-hit expiry, got %v", ttl)
+	}
+}
+
+func testBlockExpires(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	if err := h.Storage.SetBlock(ctx, "block", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocked, _ := h.Storage.IsBlocked(ctx, "block"); !blocked {
+		t.Fatalf("expected key to be blocked")
+	}
+
+	h.Advance(time.Minute)
+
+	if blocked, _ := h.Storage.IsBlocked(ctx, "block"); blocked {
+		t.Fatalf("expected block to expire")
+	}
+}
+
+func testSetBlockWithZeroDurationUnblocks(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	_ = h.Storage.SetBlock(ctx, "block", time.Minute)
+	if err := h.Storage.SetBlock(ctx, "block", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocked, _ := h.Storage.IsBlocked(ctx, "block"); blocked {
+		t.Fatalf("expected key to be unblocked")
+	}
+}
+
+func testTTLReportsMissingKeys(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	if ttl, err := h.Storage.TTL(ctx, "missing"); err != nil || ttl != 0 {
+		t.Fatalf("expected 0 for a missing key, got %v (err=%v)", ttl, err)
+	}
+
+	_ = h.Storage.SetBlock(ctx, "block", time.Minute)
+	h.Advance(15 * time.Second)
+	if ttl, _ := h.Storage.TTL(ctx, "block"); ttl != 45*time.Second {
+		t.Fatalf("expected 45s left, got %v", ttl)
+	}
+}
+
+func testKeysMatchesPatternAndDeleteRemoves(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	for _, key := range []string{"ratelimit:{ip:1.1.1.1}:block", "ratelimit:{token:t}:route:GET /a:block", "ratelimit:{ip:1.1.1.1}"} {
+		if err := h.Storage.SetBlock(ctx, key, time.Minute); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := h.Storage.SetBlock(ctx, "ratelimit:{ip:2.2.2.2}:block", time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h.Advance(time.Second)
+
+	keys, err := h.Storage.Keys(ctx, "ratelimit:*:block")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Redis lists keys in no particular order.
+	sort.Strings(keys)
+	want := []string{"ratelimit:{ip:1.1.1.1}:block", "ratelimit:{token:t}:route:GET /a:block"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+
+	if err := h.Storage.Delete(ctx, want[0], "missing"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blocked, _ := h.Storage.IsBlocked(ctx, want[0]); blocked {
+		t.Fatalf("expected deleted key to be gone")
+	}
+}
+
+func testTakeTokenRefillsOverTime(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := h.Storage.TakeToken(ctx, "bucket", 1, 2, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("expected token %d to be available", i+1)
+		}
+	}
+
+	result, _ := h.Storage.TakeToken(ctx, "bucket", 1, 2, 1)
+	if result.Allowed {
+		t.Fatalf("expected bucket to be empty")
+	}
+	if result.RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s, got %v", result.RetryAfter)
+	}
+
+	h.Advance(500 * time.Millisecond)
+	if result, _ := h.Storage.TakeToken(ctx, "bucket", 1, 2, 1); result.Allowed {
+		t.Fatalf("expected half a token to be insufficient")
+	}
+
+	h.Advance(500 * time.Millisecond)
+	if result, _ := h.Storage.TakeToken(ctx, "bucket", 1, 2, 1); !result.Allowed {
+		t.Fatalf("expected bucket to refill after one second")
+	}
+}
+
+func testTakeTokenChargesCost(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	// A cost above the burst can never fit and must leave the bucket untouched.
+	result, err := h.Storage.TakeToken(ctx, "bucket", 2, 4, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Allowed || result.Tokens != 4 {
+		t.Fatalf("expected oversized cost to be denied without charge, got %+v", result)
+	}
+
+	if result, _ := h.Storage.TakeToken(ctx, "bucket", 2, 4, 3); !result.Allowed || result.Tokens != 1 {
+		t.Fatalf("expected cost 3 to leave 1 token, got %+v", result)
+	}
+	result, _ = h.Storage.TakeToken(ctx, "bucket", 2, 4, 2)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms for the missing token, got %+v", result)
+	}
+}
+
+func testTakeSlidingLogFreesOldestEntry(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	_, _ = h.Storage.TakeSlidingLog(ctx, "log", time.Minute, 2, 1)
+	h.Advance(20 * time.Second)
+	_, _ = h.Storage.TakeSlidingLog(ctx, "log", time.Minute, 2, 1)
+
+	result, _ := h.Storage.TakeSlidingLog(ctx, "log", time.Minute, 2, 1)
+	if result.Allowed {
+		t.Fatalf("expected log to be full")
+	}
+	if result.RetryAfter != 40*time.Second {
+		t.Fatalf("expected retry after 40s, got %v", result.RetryAfter)
+	}
+
+	h.Advance(40 * time.Second)
+	result, _ = h.Storage.TakeSlidingLog(ctx, "log", time.Minute, 2, 1)
+	if !result.Allowed || result.Count != 2 {
+		t.Fatalf("expected oldest entry to leave the window, got %+v", result)
+	}
+}
+
+func testTakeSlidingWindowWeightsPreviousWindow(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if result, _ := h.Storage.TakeSlidingWindow(ctx, "sw", time.Minute, 4, 1); !result.Allowed {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	// A quarter into the next window the previous one still weighs 3 requests.
+	h.Advance(time.Minute + 15*time.Second)
+
+	result, _ := h.Storage.TakeSlidingWindow(ctx, "sw", time.Minute, 4, 1)
+	if !result.Allowed || result.Count != 4 {
+		t.Fatalf("expected one more request to fit, got %+v", result)
+	}
+
+	result, _ = h.Storage.TakeSlidingWindow(ctx, "sw", time.Minute, 4, 1)
+	if result.Allowed {
+		t.Fatalf("expected estimate to exceed the limit")
+	}
+	if result.RetryAfter != 15*time.Second {
+		t.Fatalf("expected retry after 15s, got %v", result.RetryAfter)
+	}
+}
+
+func testTakeSlidingChargesCost(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	result, err := h.Storage.TakeSlidingLog(ctx, "log", time.Minute, 3, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Allowed || result.Count != 2 {
+		t.Fatalf("expected cost 2 to fill two entries, got %+v", result)
+	}
+	h.Advance(10 * time.Second)
+	result, _ = h.Storage.TakeSlidingLog(ctx, "log", time.Minute, 3, 2)
+	if result.Allowed || result.Count != 2 || result.RetryAfter != 50*time.Second {
+		t.Fatalf("expected cost 2 to wait for the first entries, got %+v", result)
+	}
+
+	result, err = h.Storage.TakeSlidingWindow(ctx, "sw", time.Minute, 4, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Allowed || result.Count != 3 {
+		t.Fatalf("expected cost 3 to be counted, got %+v", result)
+	}
+	if result, _ := h.Storage.TakeSlidingWindow(ctx, "sw", time.Minute, 4, 2); result.Allowed || result.Count != 3 {
+		t.Fatalf("expected cost 2 to exceed the limit without charge, got %+v", result)
+	}
+}
+
+func testCompareAndSwapRequiresExpectedValue(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	if value, err := h.Storage.Get(ctx, "tat"); err != nil || value != 0 {
+		t.Fatalf("expected 0 for a missing key, got %d (err=%v)", value, err)
+	}
+
+	// Old value 0 means the key must not exist yet.
+	if swapped, err := h.Storage.CompareAndSwap(ctx, "tat", 0, 100, time.Second); err != nil || !swapped {
+		t.Fatalf("expected first swap to succeed, got %v (err=%v)", swapped, err)
+	}
+	if swapped, _ := h.Storage.CompareAndSwap(ctx, "tat", 0, 200, time.Second); swapped {
+		t.Fatalf("expected swap on an existing key to require its value")
+	}
+	if swapped, _ := h.Storage.CompareAndSwap(ctx, "tat", 99, 200, time.Second); swapped {
+		t.Fatalf("expected swap with a stale value to fail")
+	}
+	if swapped, _ := h.Storage.CompareAndSwap(ctx, "tat", 100, 200, time.Minute); !swapped {
+		t.Fatalf("expected swap with the current value to succeed")
+	}
+	if value, _ := h.Storage.Get(ctx, "tat"); value != 200 {
+		t.Fatalf("expected 200, got %d", value)
+	}
+	if ttl, _ := h.Storage.TTL(ctx, "tat"); ttl != time.Minute {
+		t.Fatalf("expected the swap to reset the ttl to 1m, got %v", ttl)
+	}
+
+	h.Advance(time.Minute)
+	if value, _ := h.Storage.Get(ctx, "tat"); value != 0 {
+		t.Fatalf("expected value to expire, got %d", value)
+	}
+}
+
+func testHitBlocksAtomically(t *testing.T, h Harness) {
+	ctx := context.Background()
+	counters := []ports.Counter{{Key: "counter", Window: time.Second, Limit: 2}}
+
+	for i := int64(1); i <= 2; i++ {
+		result, err := h.Storage.Hit(ctx, "block", counters, time.Minute, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Blocked || result.Exceeded != -1 || result.Counts[0] != i || result.TTLs[0] != time.Second {
+			t.Fatalf("unexpected result on hit %d: %+v", i, result)
+		}
+	}
+
+	// The denied hit blocks without being counted.
+	result, _ := h.Storage.Hit(ctx, "block", counters, time.Minute, 1)
+	if !result.Blocked || result.Exceeded != 0 || result.Counts[0] != 2 || result.BlockTTL != time.Minute {
+		t.Fatalf("expected hit over the limit to block, got %+v", result)
+	}
+
+	// While blocked the counter must not keep growing.
+	h.Advance(10 * time.Second)
+	result, _ = h.Storage.Hit(ctx, "block", counters, time.Minute, 1)
+	if !result.Blocked || result.Counts[0] != 0 || result.BlockTTL != 50*time.Second {
+		t.Fatalf("expected blocked hit without increment, got %+v", result)
+	}
+}
+
+func testHitCountsTiersAllOrNothing(t *testing.T, h Harness) {
+	ctx := context.Background()
+	counters := []ports.Counter{
+		{Key: "second", Window: time.Second, Limit: 2},
+		{Key: "hour", Window: time.Hour, Limit: 3},
+	}
+
+	for i := 0; i < 2; i++ {
+		if result, _ := h.Storage.Hit(ctx, "block", counters, 0, 1); result.Exceeded != -1 {
+			t.Fatalf("unexpected denial on hit %d: %+v", i+1, result)
+		}
+	}
+
+	// The short tier trips; the long tier must not be charged for the denial.
+	result, _ := h.Storage.Hit(ctx, "block", counters, 0, 1)
+	if result.Blocked || result.Exceeded != 0 || result.Counts[1] != 2 {
+		t.Fatalf("expected first tier to deny without counting, got %+v", result)
+	}
+
+	h.Advance(time.Second)
+	if result, _ := h.Storage.Hit(ctx, "block", counters, 0, 1); result.Exceeded != -1 || result.Counts[0] != 1 || result.Counts[1] != 3 {
+		t.Fatalf("expected hit in the next second to count on both tiers, got %+v", result)
+	}
+	if result, _ := h.Storage.Hit(ctx, "block", counters, 0, 1); result.Exceeded != 1 || result.TTLs[1] != time.Hour-time.Second {
+		t.Fatalf("expected second tier to deny, got %+v", result)
+	}
+}
+
+func testHitChargesCost(t *testing.T, h Harness) {
+	ctx := context.Background()
+	counters := []ports.Counter{{Key: "counter", Window: time.Minute, Limit: 3}}
+
+	result, err := h.Storage.Hit(ctx, "block", counters, 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Exceeded != -1 || result.Counts[0] != 2 {
+		t.Fatalf("expected cost 2 to be counted, got %+v", result)
+	}
+	if result, _ := h.Storage.Hit(ctx, "block", counters, 0, 2); result.Exceeded != 0 || result.Counts[0] != 2 {
+		t.Fatalf("expected cost 2 to be denied without charge, got %+v", result)
+	}
+	if result, _ := h.Storage.Hit(ctx, "block", counters, 0, 1); result.Exceeded != -1 || result.Counts[0] != 3 {
+		t.Fatalf("expected cost 1 to still fit, got %+v", result)
+	}
+}
+
+func testSlotsAreReleasedOrExpire(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	_, _ = h.Storage.AcquireSlot(ctx, "slots", "a", 2, time.Minute)
+	h.Advance(30 * time.Second)
+	_, _ = h.Storage.AcquireSlot(ctx, "slots", "b", 2, time.Minute)
+
+	if result, _ := h.Storage.AcquireSlot(ctx, "slots", "c", 2, time.Minute); result.Acquired || result.InUse != 2 {
+		t.Fatalf("expected slots to be exhausted, got %+v", result)
+	}
+
+	_ = h.Storage.ReleaseSlot(ctx, "slots", "b")
+	if result, _ := h.Storage.AcquireSlot(ctx, "slots", "c", 2, time.Minute); !result.Acquired || result.InUse != 2 {
+		t.Fatalf("expected released slot to be reused, got %+v", result)
+	}
+
+	// The lease of "a" ends without a release, as if its instance crashed.
+	h.Advance(30 * time.Second)
+	if result, _ := h.Storage.AcquireSlot(ctx, "slots", "d", 2, time.Minute); !result.Acquired || result.InUse != 2 {
+		t.Fatalf("expected expired lease to free its slot, got %+v", result)
+	}
+}
@@ -0,0 +1,32 @@
+// Package clocktest disponibiliza um relógio controlado manualmente para os testes.
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// Start é o instante inicial de todo Clock criado por New.
+var Start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock só avança quando Advance é chamado. É seguro para uso concorrente.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func New() *Clock {
+	return &Clock{now: Start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
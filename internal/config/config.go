@@ -3,6 +3,7 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
@@ -17,34 +18,130 @@ type Config struct {
 	Server      ServerConfig
 	Storage     StorageConfig
 	RateLimiter RateLimiterConfig
+	Metrics     MetricsConfig
 }
 
 type ServerConfig struct {
 	Port string
+	// IETFRateLimitHeaders habilita os headers RateLimit/RateLimit-Policy do draft da IETF.
+	IETFRateLimitHeaders bool
+	// TrustedProxies lista os proxies cujos headers de encaminhamento são aceitos.
+	TrustedProxies []netip.Prefix
+	// ClientIPHeaders define os headers consultados, em ordem, para descobrir o IP do cliente.
+	ClientIPHeaders []string
+	// CostHeader, quando definido, é o header de onde vem o custo de cada requisição.
+	CostHeader string
+	// AdminToken habilita a API administrativa em /admin, autenticada com esse bearer token.
+	AdminToken string
+	// GRPCPort habilita o serviço de rate limit do Envoy (gRPC) nessa porta.
+	GRPCPort string
+}
+
+type MetricsConfig struct {
+	Enabled bool
+	Path    string
 }
 
 type StorageConfig struct {
-	Type  string
-	Redis RedisConfig
+	Type       string
+	Redis      RedisConfig
+	Memory     MemoryConfig
+	Breaker    BreakerConfig
+	BlockCache BlockCacheConfig
+}
+
+// BlockCacheConfig configura o cache local dos bloqueios aplicado ao storage Redis.
+type BlockCacheConfig struct {
+	Enabled    bool
+	MaxEntries int
+}
+
+// BreakerConfig configura o circuit breaker aplicado ao storage Redis.
+type BreakerConfig struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
 }
 
 type RedisConfig struct {
 	Host     string
 	Port     int
+	Username string
 	Password string
 	DB       int
+	// URL, quando definida, substitui Host, Port, Username, Password e DB.
+	URL string
+	// SentinelMaster e SentinelAddrs ativam o Sentinel; ClusterAddrs ativa o Cluster.
+	SentinelMaster   string
+	SentinelAddrs    []string
+	SentinelPassword string
+	ClusterAddrs     []string
+
+	TLS       bool
+	TLSCAFile string
+
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+type MemoryConfig struct {
+	Shards          int
+	CleanupInterval time.Duration
 }
 
 type RateLimiterConfig struct {
+	IPv4Prefix       int
+	IPv6Prefix       int
 	IPRule           domain.RateLimitRule
 	DefaultTokenRule domain.RateLimitRule
 	TokenRules       map[string]domain.RateLimitRule
+	// Combined aplica os limites de token e de IP juntos; PairRule limita o par token+IP.
+	Combined bool
+	PairRule domain.RateLimitRule
+	// RouteRules só podem ser definidas no arquivo de regras.
+	RouteRules []domain.RouteRule
+	// AllowList isenta IPs, CIDRs e tokens do rate limiting; DenyList os recusa com 403.
+	AllowList domain.AccessList
+	DenyList  domain.AccessList
+	// FailurePolicy define a decisão quando o storage falha: closed, open ou fallback.
+	FailurePolicy domain.FailurePolicy
+	// Shadow coloca todas as regras em modo shadow: nada é negado por limite, apenas registrado.
+	Shadow bool
+	// RulesFile aponta para um arquivo YAML/JSON de regras que substitui as regras
+	// definidas por variáveis de ambiente e é recarregado quando muda.
+	RulesFile           string
+	RulesReloadInterval time.Duration
 }
 
 func Load() (Config, error) {
 	_ = godotenv.Load()
 
-	server := ServerConfig{Port: getEnv("SERVER_PORT", "8080")}
+	ietfHeaders, err := strconv.ParseBool(getEnv("RATE_LIMIT_IETF_HEADERS", "false"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid RATE_LIMIT_IETF_HEADERS: %w", err)
+	}
+
+	trustedProxies, err := parsePrefixes(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	server := ServerConfig{
+		Port:                 getEnv("SERVER_PORT", "8080"),
+		IETFRateLimitHeaders: ietfHeaders,
+		TrustedProxies:       trustedProxies,
+		ClientIPHeaders:      splitNonEmpty(os.Getenv("CLIENT_IP_HEADERS")),
+		CostHeader:           strings.TrimSpace(os.Getenv("RATE_LIMIT_COST_HEADER")),
+		AdminToken:           strings.TrimSpace(os.Getenv("ADMIN_TOKEN")),
+		GRPCPort:             strings.TrimSpace(os.Getenv("GRPC_PORT")),
+	}
+
+	metricsEnabled, err := strconv.ParseBool(getEnv("METRICS_ENABLED", "false"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid METRICS_ENABLED: %w", err)
+	}
 
 	storageType := getEnv("STORAGE_TYPE", "redis")
 
@@ -53,18 +150,46 @@ func Load() (Config, error) {
 		return Config{}, err
 	}
 
+	memoryConfig, err := buildMemoryConfig()
+	if err != nil {
+		return Config{}, err
+	}
+
+	breakerConfig, err := buildBreakerConfig()
+	if err != nil {
+		return Config{}, err
+	}
+
+	blockCacheConfig, err := buildBlockCacheConfig()
+	if err != nil {
+		return Config{}, err
+	}
+
 	rateLimiterConfig, err := buildRateLimiterConfig()
 	if err != nil {
 		return Config{}, err
 	}
+	if rateLimiterConfig.RulesFile != "" {
+		rateLimiterConfig, err = loadRulesFile(rateLimiterConfig.RulesFile, rateLimiterConfig)
+		if err != nil {
+			return Config{}, err
+		}
+	}
 
 	return Config{
 		Server: server,
 		Storage: StorageConfig{
-			Type:  storageType,
-			Redis: redisConfig,
+			Type:       storageType,
+			Redis:      redisConfig,
+			Memory:     memoryConfig,
+			Breaker:    breakerConfig,
+			BlockCache: blockCacheConfig,
 		},
 		RateLimiter: rateLimiterConfig,
+		Metrics: MetricsConfig{
+			Enabled: metricsEnabled,
+			Path:    getEnv("METRICS_PATH", "/metrics"),
+		},
 	}, nil
 }
 
@@ -78,15 +203,103 @@ func buildRedisConfig() (RedisConfig, error) {
 	if err != nil {
 		return RedisConfig{}, fmt.Errorf("invalid REDIS_DB: %w", err)
 	}
+	useTLS, err := strconv.ParseBool(getEnv("REDIS_TLS", "false"))
+	if err != nil {
+		return RedisConfig{}, fmt.Errorf("invalid REDIS_TLS: %w", err)
+	}
+
+	cfg := RedisConfig{
+		Host:             host,
+		Port:             port,
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		DB:               db,
+		URL:              strings.TrimSpace(os.Getenv("REDIS_URL")),
+		SentinelMaster:   strings.TrimSpace(os.Getenv("REDIS_SENTINEL_MASTER")),
+		SentinelAddrs:    splitNonEmpty(os.Getenv("REDIS_SENTINEL_ADDRS")),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		ClusterAddrs:     splitNonEmpty(os.Getenv("REDIS_CLUSTER_ADDRS")),
+		TLS:              useTLS,
+		TLSCAFile:        strings.TrimSpace(os.Getenv("REDIS_TLS_CA_FILE")),
+	}
 
-	return RedisConfig{
-		Host:     host,
-		Port:     port,
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       db,
+	for name, target := range map[string]*int{
+		"REDIS_POOL_SIZE":      &cfg.PoolSize,
+		"REDIS_MIN_IDLE_CONNS": &cfg.MinIdleConns,
+	} {
+		value, err := strconv.Atoi(getEnv(name, "0"))
+		if err != nil || value < 0 {
+			return RedisConfig{}, fmt.Errorf("invalid %s: must be a non-negative integer", name)
+		}
+		*target = value
+	}
+	for name, target := range map[string]*time.Duration{
+		"REDIS_DIAL_TIMEOUT_MS":  &cfg.DialTimeout,
+		"REDIS_READ_TIMEOUT_MS":  &cfg.ReadTimeout,
+		"REDIS_WRITE_TIMEOUT_MS": &cfg.WriteTimeout,
+	} {
+		ms, err := strconv.Atoi(getEnv(name, "0"))
+		if err != nil || ms < 0 {
+			return RedisConfig{}, fmt.Errorf("invalid %s: must be a non-negative integer", name)
+		}
+		*target = time.Duration(ms) * time.Millisecond
+	}
+
+	if cfg.SentinelMaster != "" && len(cfg.SentinelAddrs) == 0 {
+		return RedisConfig{}, fmt.Errorf("REDIS_SENTINEL_ADDRS is required when REDIS_SENTINEL_MASTER is set")
+	}
+	if cfg.SentinelMaster != "" && len(cfg.ClusterAddrs) > 0 {
+		return RedisConfig{}, fmt.Errorf("REDIS_SENTINEL_MASTER and REDIS_CLUSTER_ADDRS are mutually exclusive")
+	}
+
+	return cfg, nil
+}
+
+func buildMemoryConfig() (MemoryConfig, error) {
+	shards, err := strconv.Atoi(getEnv("MEMORY_SHARDS", "64"))
+	if err != nil {
+		return MemoryConfig{}, fmt.Errorf("invalid MEMORY_SHARDS: %w", err)
+	}
+	cleanupSeconds, err := strconv.Atoi(getEnv("MEMORY_CLEANUP_INTERVAL_SECONDS", "60"))
+	if err != nil {
+		return MemoryConfig{}, fmt.Errorf("invalid MEMORY_CLEANUP_INTERVAL_SECONDS: %w", err)
+	}
+
+	return MemoryConfig{
+		Shards:          shards,
+		CleanupInterval: time.Duration(cleanupSeconds) * time.Second,
 	}, nil
 }
 
+func buildBreakerConfig() (BreakerConfig, error) {
+	threshold, err := strconv.Atoi(getEnv("STORAGE_BREAKER_FAILURE_THRESHOLD", "5"))
+	if err != nil || threshold <= 0 {
+		return BreakerConfig{}, fmt.Errorf("invalid STORAGE_BREAKER_FAILURE_THRESHOLD: must be a positive integer")
+	}
+	openSeconds, err := strconv.Atoi(getEnv("STORAGE_BREAKER_OPEN_SECONDS", "10"))
+	if err != nil || openSeconds <= 0 {
+		return BreakerConfig{}, fmt.Errorf("invalid STORAGE_BREAKER_OPEN_SECONDS: must be a positive integer")
+	}
+
+	return BreakerConfig{
+		FailureThreshold: threshold,
+		OpenDuration:     time.Duration(openSeconds) * time.Second,
+	}, nil
+}
+
+func buildBlockCacheConfig() (BlockCacheConfig, error) {
+	enabled, err := strconv.ParseBool(getEnv("BLOCK_CACHE_ENABLED", "true"))
+	if err != nil {
+		return BlockCacheConfig{}, fmt.Errorf("invalid BLOCK_CACHE_ENABLED: %w", err)
+	}
+	maxEntries, err := strconv.Atoi(getEnv("BLOCK_CACHE_MAX_ENTRIES", "100000"))
+	if err != nil || maxEntries <= 0 {
+		return BlockCacheConfig{}, fmt.Errorf("invalid BLOCK_CACHE_MAX_ENTRIES: must be a positive integer")
+	}
+
+	return BlockCacheConfig{Enabled: enabled, MaxEntries: maxEntries}, nil
+}
+
 func buildRateLimiterConfig() (RateLimiterConfig, error) {
 	ipRequests, err := strconv.Atoi(getEnv("RATE_LIMIT_IP_REQUESTS", "10"))
 	if err != nil {
@@ -101,53 +314,238 @@ func buildRateLimiterConfig() (RateLimiterConfig, error) {
 		return RateLimiterConfig{}, fmt.Errorf("invalid RATE_LIMIT_IP_BLOCK_DURATION_MINUTES: %w", err)
 	}
 
-	defaultTokenRule, err := buildOptionalTokenRule()
+	ipRule := domain.RateLimitRule{
+		Requests:      ipRequests,
+		Window:        time.Duration(ipWindowSeconds) * time.Second,
+		BlockDuration: time.Duration(ipBlockMinutes) * time.Minute,
+	}
+	if err := applyAlgorithmEnv(&ipRule, "RATE_LIMIT_IP"); err != nil {
+		return RateLimiterConfig{}, err
+	}
+
+	defaultTokenRule, err := buildOptionalRule("RATE_LIMIT_TOKEN_DEFAULT")
+	if err != nil {
+		return RateLimiterConfig{}, err
+	}
+
+	combined, err := strconv.ParseBool(getEnv("RATE_LIMIT_COMBINED", "false"))
+	if err != nil {
+		return RateLimiterConfig{}, fmt.Errorf("invalid RATE_LIMIT_COMBINED: %w", err)
+	}
+	pairRule, err := buildOptionalRule("RATE_LIMIT_PAIR")
 	if err != nil {
 		return RateLimiterConfig{}, err
 	}
+	shadow, err := strconv.ParseBool(getEnv("RATE_LIMIT_SHADOW", "false"))
+	if err != nil {
+		return RateLimiterConfig{}, fmt.Errorf("invalid RATE_LIMIT_SHADOW: %w", err)
+	}
+
+	ipv4Prefix, err := strconv.Atoi(getEnv("RATE_LIMIT_IPV4_PREFIX", "32"))
+	if err != nil {
+		return RateLimiterConfig{}, fmt.Errorf("invalid RATE_LIMIT_IPV4_PREFIX: %w", err)
+	}
+	ipv6Prefix, err := strconv.Atoi(getEnv("RATE_LIMIT_IPV6_PREFIX", "64"))
+	if err != nil {
+		return RateLimiterConfig{}, fmt.Errorf("invalid RATE_LIMIT_IPV6_PREFIX: %w", err)
+	}
 
 	tokenRules, err := buildTokenOverrides()
 	if err != nil {
 		return RateLimiterConfig{}, err
 	}
 
+	allowList, err := buildAccessList("RATE_LIMIT_ALLOW")
+	if err != nil {
+		return RateLimiterConfig{}, err
+	}
+	denyList, err := buildAccessList("RATE_LIMIT_DENY")
+	if err != nil {
+		return RateLimiterConfig{}, err
+	}
+
+	failurePolicy := domain.FailurePolicy(strings.ToLower(getEnv("RATE_LIMIT_FAILURE_POLICY", string(domain.FailClosed))))
+	if err := failurePolicy.Validate(); err != nil {
+		return RateLimiterConfig{}, fmt.Errorf("invalid RATE_LIMIT_FAILURE_POLICY: %w", err)
+	}
+
+	reloadSeconds, err := strconv.Atoi(getEnv("RATE_LIMIT_RULES_RELOAD_INTERVAL_SECONDS", "5"))
+	if err != nil || reloadSeconds <= 0 {
+		return RateLimiterConfig{}, fmt.Errorf("invalid RATE_LIMIT_RULES_RELOAD_INTERVAL_SECONDS: must be a positive integer")
+	}
+
 	return RateLimiterConfig{
-		IPRule: domain.RateLimitRule{
-			Requests:      ipRequests,
-			Window:        time.Duration(ipWindowSeconds) * time.Second,
-			BlockDuration: time.Duration(ipBlockMinutes) * time.Minute,
-		},
-		DefaultTokenRule: defaultTokenRule,
-		TokenRules:       tokenRules,
+		IPv4Prefix:          ipv4Prefix,
+		IPv6Prefix:          ipv6Prefix,
+		IPRule:              ipRule,
+		DefaultTokenRule:    defaultTokenRule,
+		TokenRules:          tokenRules,
+		Combined:            combined,
+		PairRule:            pairRule,
+		AllowList:           allowList,
+		DenyList:            denyList,
+		FailurePolicy:       failurePolicy,
+		Shadow:              shadow,
+		RulesFile:           strings.TrimSpace(os.Getenv("RATE_LIMIT_RULES_FILE")),
+		RulesReloadInterval: time.Duration(reloadSeconds) * time.Second,
 	}, nil
 }
 
-func buildOptionalTokenRule() (domain.RateLimitRule, error) {
-	requestsStr := os.Getenv("RATE_LIMIT_TOKEN_DEFAULT_REQUESTS")
+// buildAccessList lê <PREFIX>_IPS (IPs ou CIDRs) e <PREFIX>_TOKENS, separados por vírgula.
+func buildAccessList(prefix string) (domain.AccessList, error) {
+	prefixes, err := parsePrefixes(os.Getenv(prefix + "_IPS"))
+	if err != nil {
+		return domain.AccessList{}, fmt.Errorf("invalid %s_IPS: %w", prefix, err)
+	}
+	return domain.AccessList{Prefixes: prefixes, Tokens: splitNonEmpty(os.Getenv(prefix + "_TOKENS"))}, nil
+}
+
+// buildOptionalRule lê <PREFIX>_REQUESTS, <PREFIX>_WINDOW_SECONDS e
+// <PREFIX>_BLOCK_DURATION_MINUTES; sem <PREFIX>_REQUESTS a regra fica desativada.
+func buildOptionalRule(prefix string) (domain.RateLimitRule, error) {
+	requestsStr := os.Getenv(prefix + "_REQUESTS")
 	if strings.TrimSpace(requestsStr) == "" {
 		return domain.RateLimitRule{}, nil
 	}
 
 	requests, err := strconv.Atoi(requestsStr)
 	if err != nil {
-		return domain.RateLimitRule{}, fmt.Errorf("invalid RATE_LIMIT_TOKEN_DEFAULT_REQUESTS: %w", err)
+		return domain.RateLimitRule{}, fmt.Errorf("invalid %s_REQUESTS: %w", prefix, err)
 	}
 
-	windowSeconds, err := strconv.Atoi(getEnv("RATE_LIMIT_TOKEN_DEFAULT_WINDOW_SECONDS", "1"))
+	windowSeconds, err := strconv.Atoi(getEnv(prefix+"_WINDOW_SECONDS", "1"))
 	if err != nil {
-		return domain.RateLimitRule{}, fmt.Errorf("invalid RATE_LIMIT_TOKEN_DEFAULT_WINDOW_SECONDS: %w", err)
+		return domain.RateLimitRule{}, fmt.Errorf("invalid %s_WINDOW_SECONDS: %w", prefix, err)
 	}
 
-	blockMinutes, err := strconv.Atoi(getEnv("RATE_LIMIT_TOKEN_DEFAULT_BLOCK_DURATION_MINUTES", "5"))
+	blockMinutes, err := strconv.Atoi(getEnv(prefix+"_BLOCK_DURATION_MINUTES", "5"))
 	if err != nil {
-		return domain.RateLimitRule{}, fmt.Errorf("invalid RATE_LIMIT_TOKEN_DEFAULT_BLOCK_DURATION_MINUTES: %w", err)
+		return domain.RateLimitRule{}, fmt.Errorf("invalid %s_BLOCK_DURATION_MINUTES: %w", prefix, err)
 	}
 
-	return domain.RateLimitRule{
+	rule := domain.RateLimitRule{
 		Requests:      requests,
 		Window:        time.Duration(windowSeconds) * time.Second,
 		BlockDuration: time.Duration(blockMinutes) * time.Minute,
-	}, nil
+	}
+	if err := applyAlgorithmEnv(&rule, prefix); err != nil {
+		return domain.RateLimitRule{}, err
+	}
+
+	return rule, nil
+}
+
+// applyAlgorithmEnv lê <PREFIX>_ALGORITHM, <PREFIX>_REFILL_RATE, <PREFIX>_BURST,
+// <PREFIX>_MAX_DELAY, <PREFIX>_TIERS, <PREFIX>_BLOCK_ESCALATION, <PREFIX>_BLOCK_ESCALATION_MEMORY,
+// <PREFIX>_SHADOW, <PREFIX>_PERIOD e <PREFIX>_TIME_ZONE. Um período substitui a janela.
+func applyAlgorithmEnv(rule *domain.RateLimitRule, prefix string) error {
+	rule.Algorithm = domain.Algorithm(getEnv(prefix+"_ALGORITHM", string(domain.AlgorithmFixedWindow)))
+
+	if raw := strings.TrimSpace(os.Getenv(prefix + "_REFILL_RATE")); raw != "" {
+		rate, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s_REFILL_RATE: %w", prefix, err)
+		}
+		rule.RefillRate = rate
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(prefix + "_BURST")); raw != "" {
+		burst, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s_BURST: %w", prefix, err)
+		}
+		rule.Burst = burst
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(prefix + "_MAX_DELAY")); raw != "" {
+		maxDelay, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s_MAX_DELAY: %w", prefix, err)
+		}
+		rule.MaxDelay = maxDelay
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(prefix + "_PERIOD")); raw != "" {
+		rule.Period = domain.Period(strings.ToLower(raw))
+		rule.Window = 0
+	}
+	if raw := strings.TrimSpace(os.Getenv(prefix + "_TIME_ZONE")); raw != "" {
+		loc, err := time.LoadLocation(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s_TIME_ZONE: %w", prefix, err)
+		}
+		rule.Location = loc
+	}
+
+	tiers, err := parseTiers(os.Getenv(prefix + "_TIERS"))
+	if err != nil {
+		return fmt.Errorf("invalid %s_TIERS: %w", prefix, err)
+	}
+	rule.Tiers = tiers
+
+	escalation, err := parseDurations(os.Getenv(prefix + "_BLOCK_ESCALATION"))
+	if err != nil {
+		return fmt.Errorf("invalid %s_BLOCK_ESCALATION: %w", prefix, err)
+	}
+	rule.Escalation = escalation
+
+	if raw := strings.TrimSpace(os.Getenv(prefix + "_BLOCK_ESCALATION_MEMORY")); raw != "" {
+		memory, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s_BLOCK_ESCALATION_MEMORY: %w", prefix, err)
+		}
+		rule.EscalationMemory = memory
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(prefix + "_SHADOW")); raw != "" {
+		shadow, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s_SHADOW: %w", prefix, err)
+		}
+		rule.Shadow = shadow
+	}
+
+	return nil
+}
+
+// parseDurations converte uma lista como "1m,5m,30m,24h" em durações.
+func parseDurations(raw string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for _, item := range splitNonEmpty(raw) {
+		d, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+// parseTiers converte uma lista como "1000/1h,20000/24h" em tiers adicionais. No lugar
+// da janela também é aceito um período de calendário, como em "10000/month".
+func parseTiers(raw string) ([]domain.Tier, error) {
+	var tiers []domain.Tier
+	for _, item := range splitNonEmpty(raw) {
+		requestsStr, windowStr, found := strings.Cut(item, "/")
+		if !found {
+			return nil, fmt.Errorf("tier must follow REQUESTS/WINDOW: %s", item)
+		}
+		requests, err := strconv.Atoi(strings.TrimSpace(requestsStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid requests in tier %s: %w", item, err)
+		}
+		windowStr = strings.TrimSpace(windowStr)
+		if period := domain.Period(strings.ToLower(windowStr)); period.Validate() == nil {
+			tiers = append(tiers, domain.Tier{Requests: requests, Period: period})
+			continue
+		}
+		window, err := time.ParseDuration(windowStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window in tier %s: %w", item, err)
+		}
+		tiers = append(tiers, domain.Tier{Requests: requests, Window: window})
+	}
+	return tiers, nil
 }
 
 func buildTokenOverrides() (map[string]domain.RateLimitRule, error) {
@@ -161,8 +559,8 @@ func buildTokenOverrides() (map[string]domain.RateLimitRule, error) {
 
 	for _, item := range items {
 		parts := strings.Split(strings.TrimSpace(item), ":")
-		if len(parts) != 4 {
-			return nil, fmt.Errorf("token override must follow TOKEN:REQUESTS:WINDOW_SECONDS:BLOCK_DURATION_MINUTES: %s", item)
+		if len(parts) != 4 && len(parts) != 5 {
+			return nil, fmt.Errorf("token override must follow TOKEN:REQUESTS:WINDOW_SECONDS:BLOCK_DURATION_MINUTES[:ALGORITHM]: %s", item)
 		}
 
 		token := strings.TrimSpace(parts[0])
@@ -179,16 +577,60 @@ func buildTokenOverrides() (map[string]domain.RateLimitRule, error) {
 			return nil, fmt.Errorf("invalid block minutes for token %s: %w", token, err)
 		}
 
-		overrides[token] = domain.RateLimitRule{
+		rule := domain.RateLimitRule{
 			Requests:      requests,
 			Window:        time.Duration(windowSeconds) * time.Second,
 			BlockDuration: time.Duration(blockMinutes) * time.Minute,
 		}
+		if len(parts) == 5 {
+			rule.Algorithm = domain.Algorithm(strings.TrimSpace(parts[4]))
+		}
+
+		overrides[token] = rule
 	}
 
 	return overrides, nil
 }
 
+// parsePrefixes converte uma lista separada por vírgulas de CIDRs ou IPs isolados.
+func parsePrefixes(raw string) ([]netip.Prefix, error) {
+	return parsePrefixList(splitNonEmpty(raw))
+}
+
+// parsePrefixList aceita CIDRs e IPs isolados, que viram prefixos /32 ou /128.
+func parsePrefixList(items []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func splitNonEmpty(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnv(key, fallback string) string {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
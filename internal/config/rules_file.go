@@ -0,0 +1,315 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+// rulesFile descreve o arquivo declarativo de regras. Por ser YAML, o mesmo formato
+// também aceita JSON.
+type rulesFile struct {
+	IP           *ruleSpec           `yaml:"ip"`
+	TokenDefault *ruleSpec           `yaml:"token_default"`
+	Tokens       map[string]ruleSpec `yaml:"tokens"`
+	Combined     *bool               `yaml:"combined"`
+	Shadow       *bool               `yaml:"shadow"`
+	Pair         *ruleSpec           `yaml:"pair"`
+	Routes       []routeSpec         `yaml:"routes"`
+	Allow        *accessListSpec     `yaml:"allow"`
+	Deny         *accessListSpec     `yaml:"deny"`
+	IPv4Prefix   int                 `yaml:"ipv4_prefix"`
+	IPv6Prefix   int                 `yaml:"ipv6_prefix"`
+}
+
+// accessListSpec lista IPs ou CIDRs e tokens de uma lista de permissão ou bloqueio.
+type accessListSpec struct {
+	IPs    []string `yaml:"ips"`
+	Tokens []string `yaml:"tokens"`
+}
+
+func (l accessListSpec) toDomain() (domain.AccessList, error) {
+	prefixes, err := parsePrefixList(l.IPs)
+	if err != nil {
+		return domain.AccessList{}, err
+	}
+	return domain.AccessList{Prefixes: prefixes, Tokens: l.Tokens}, nil
+}
+
+type ruleSpec struct {
+	Algorithm     domain.Algorithm `yaml:"algorithm"`
+	Requests      int              `yaml:"requests"`
+	Window        duration         `yaml:"window"`
+	BlockDuration duration         `yaml:"block_duration"`
+	RefillRate    float64          `yaml:"refill_rate"`
+	Burst         int              `yaml:"burst"`
+	Tiers         []tierSpec       `yaml:"tiers"`
+	MaxDelay      duration         `yaml:"max_delay"`
+	// Period e TimeZone alinham o limite ao calendário, no lugar de window.
+	Period   domain.Period `yaml:"period"`
+	TimeZone timeZone      `yaml:"time_zone"`
+	// BlockEscalation e EscalationMemory escalonam o bloqueio para reincidentes.
+	BlockEscalation  []duration `yaml:"block_escalation"`
+	EscalationMemory duration   `yaml:"escalation_memory"`
+	// Shadow avalia a regra sem negar requisições.
+	Shadow bool `yaml:"shadow"`
+}
+
+type tierSpec struct {
+	Requests int           `yaml:"requests"`
+	Window   duration      `yaml:"window"`
+	Period   domain.Period `yaml:"period"`
+}
+
+// routeSpec combina os campos da regra com o método, o padrão chi, o custo e o limite
+// de concorrência da rota. Sem os campos da regra, a rota usa a regra global.
+type routeSpec struct {
+	Method      string           `yaml:"method"`
+	Pattern     string           `yaml:"pattern"`
+	Cost        int64            `yaml:"cost"`
+	Concurrency *concurrencySpec `yaml:"concurrency"`
+	ruleSpec    `yaml:",inline"`
+}
+
+// concurrencySpec limita as requisições em andamento de cada identificador na rota.
+type concurrencySpec struct {
+	Limit int      `yaml:"limit"`
+	Lease duration `yaml:"lease"`
+}
+
+func (r ruleSpec) toDomain() domain.RateLimitRule {
+	rule := domain.RateLimitRule{
+		Algorithm:     r.Algorithm,
+		Requests:      r.Requests,
+		Window:        time.Duration(r.Window),
+		BlockDuration: time.Duration(r.BlockDuration),
+		Period:        r.Period,
+		Location:      r.TimeZone.Location,
+		RefillRate:    r.RefillRate,
+		Burst:         r.Burst,
+		MaxDelay:      time.Duration(r.MaxDelay),
+		Shadow:        r.Shadow,
+	}
+	for _, tier := range r.Tiers {
+		rule.Tiers = append(rule.Tiers, domain.Tier{Requests: tier.Requests, Window: time.Duration(tier.Window), Period: tier.Period})
+	}
+	for _, block := range r.BlockEscalation {
+		rule.Escalation = append(rule.Escalation, time.Duration(block))
+	}
+	rule.EscalationMemory = time.Duration(r.EscalationMemory)
+	return rule
+}
+
+// duration aceita strings no formato de time.ParseDuration, como "500ms" ou "1h30m".
+type duration time.Duration
+
+func (d *duration) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// timeZone aceita nomes de fuso da base IANA, como "America/Sao_Paulo" ou "UTC".
+type timeZone struct {
+	*time.Location
+}
+
+func (z *timeZone) UnmarshalYAML(node *yaml.Node) error {
+	var name string
+	if err := node.Decode(&name); err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	z.Location = loc
+	return nil
+}
+
+// loadRulesFile lê o arquivo de regras e o aplica sobre base. As regras do arquivo
+// substituem as vindas de variáveis de ambiente; os prefixos, o modo combinado e as
+// listas de permissão e bloqueio só são substituídos quando informados.
+func loadRulesFile(path string, base RateLimiterConfig) (RateLimiterConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return RateLimiterConfig{}, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return parseRules(content, base)
+}
+
+func parseRules(content []byte, base RateLimiterConfig) (RateLimiterConfig, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	var file rulesFile
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return RateLimiterConfig{}, fmt.Errorf("invalid rules file: %w", err)
+	}
+
+	if file.IP == nil {
+		return RateLimiterConfig{}, fmt.Errorf("invalid rules file: ip rule is required")
+	}
+
+	cfg := base
+	cfg.IPRule = file.IP.toDomain()
+	if err := cfg.IPRule.Validate(); err != nil {
+		return RateLimiterConfig{}, fmt.Errorf("invalid rules file: ip: %w", err)
+	}
+
+	cfg.DefaultTokenRule = domain.RateLimitRule{}
+	if file.TokenDefault != nil {
+		cfg.DefaultTokenRule = file.TokenDefault.toDomain()
+		if err := cfg.DefaultTokenRule.Validate(); err != nil {
+			return RateLimiterConfig{}, fmt.Errorf("invalid rules file: token_default: %w", err)
+		}
+	}
+
+	if file.Combined != nil {
+		cfg.Combined = *file.Combined
+	}
+	if file.Shadow != nil {
+		cfg.Shadow = *file.Shadow
+	}
+	cfg.PairRule = domain.RateLimitRule{}
+	if file.Pair != nil {
+		cfg.PairRule = file.Pair.toDomain()
+		if err := cfg.PairRule.Validate(); err != nil {
+			return RateLimiterConfig{}, fmt.Errorf("invalid rules file: pair: %w", err)
+		}
+	}
+
+	cfg.TokenRules = make(map[string]domain.RateLimitRule, len(file.Tokens))
+	for token, spec := range file.Tokens {
+		rule := spec.toDomain()
+		if err := rule.Validate(); err != nil {
+			return RateLimiterConfig{}, fmt.Errorf("invalid rules file: tokens.%s: %w", token, err)
+		}
+		cfg.TokenRules[token] = rule
+	}
+
+	cfg.RouteRules = make([]domain.RouteRule, 0, len(file.Routes))
+	for _, spec := range file.Routes {
+		if spec.Pattern == "" {
+			return RateLimiterConfig{}, fmt.Errorf("invalid rules file: routes: pattern is required")
+		}
+		if spec.Cost < 0 {
+			return RateLimiterConfig{}, fmt.Errorf("invalid rules file: routes.%s %s: cost must not be negative", spec.Method, spec.Pattern)
+		}
+		rule := spec.toDomain()
+		if !rule.IsZero() || (spec.Cost == 0 && spec.Concurrency == nil) {
+			if err := rule.Validate(); err != nil {
+				return RateLimiterConfig{}, fmt.Errorf("invalid rules file: routes.%s %s: %w", spec.Method, spec.Pattern, err)
+			}
+		}
+		route := domain.RouteRule{Method: spec.Method, Pattern: spec.Pattern, Rule: rule, Cost: spec.Cost}
+		if spec.Concurrency != nil {
+			route.Concurrency = domain.ConcurrencyRule{Limit: spec.Concurrency.Limit, Lease: time.Duration(spec.Concurrency.Lease)}
+			if err := route.Concurrency.Validate(); err != nil {
+				return RateLimiterConfig{}, fmt.Errorf("invalid rules file: routes.%s %s: concurrency: %w", spec.Method, spec.Pattern, err)
+			}
+		}
+		cfg.RouteRules = append(cfg.RouteRules, route)
+	}
+
+	if file.Allow != nil {
+		list, err := file.Allow.toDomain()
+		if err != nil {
+			return RateLimiterConfig{}, fmt.Errorf("invalid rules file: allow: %w", err)
+		}
+		cfg.AllowList = list
+	}
+	if file.Deny != nil {
+		list, err := file.Deny.toDomain()
+		if err != nil {
+			return RateLimiterConfig{}, fmt.Errorf("invalid rules file: deny: %w", err)
+		}
+		cfg.DenyList = list
+	}
+
+	if file.IPv4Prefix != 0 {
+		cfg.IPv4Prefix = file.IPv4Prefix
+	}
+	if file.IPv6Prefix != 0 {
+		cfg.IPv6Prefix = file.IPv6Prefix
+	}
+
+	return cfg, nil
+}
+
+// WatchRulesFile verifica cfg.RulesFile a cada cfg.RulesReloadInterval e, quando o
+// conteúdo muda, entrega a nova configuração para apply. Arquivos inválidos ou
+// rejeitados por apply são registrados em log e a configuração atual é mantida.
+// Comparar o conteúdo, e não a data de modificação, também cobre a troca de symlinks
+// feita por ConfigMaps do Kubernetes. Bloqueia até ctx ser cancelado.
+func WatchRulesFile(ctx context.Context, cfg RateLimiterConfig, apply func(RateLimiterConfig) error) {
+	if cfg.RulesFile == "" {
+		return
+	}
+
+	// As regras do arquivo são aplicadas sobre as do ambiente, para que um campo
+	// removido do arquivo volte ao valor original em vez de manter o anterior.
+	base, err := buildRateLimiterConfig()
+	if err != nil {
+		base = cfg
+	}
+
+	ticker := time.NewTicker(cfg.RulesReloadInterval)
+	defer ticker.Stop()
+
+	lastHash := hashFile(cfg.RulesFile)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		content, err := os.ReadFile(cfg.RulesFile)
+		if err != nil {
+			log.Printf("failed to read rules file %s: %v", cfg.RulesFile, err)
+			continue
+		}
+		hash := sha256.Sum256(content)
+		if hash == lastHash {
+			continue
+		}
+		lastHash = hash
+
+		next, err := parseRules(content, base)
+		if err == nil {
+			err = apply(next)
+		}
+		if err != nil {
+			log.Printf("rules file %s rejected, keeping current rules: %v", cfg.RulesFile, err)
+			continue
+		}
+		log.Printf("rules file %s reloaded", cfg.RulesFile)
+	}
+}
+
+func hashFile(path string) [sha256.Size]byte {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(content)
+}
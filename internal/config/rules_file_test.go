@@ -0,0 +1,233 @@
+package config
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestParseRules(t *testing.T) {
+	content := `
+ip:
+  requests: 10
+  window: 1s
+  block_duration: 5m
+  tiers:
+    - requests: 1000
+      window: 1h
+token_default:
+  algorithm: token_bucket
+  refill_rate: 2.5
+  burst: 20
+tokens:
+  abc123:
+    algorithm: sliding_window
+    requests: 100
+    window: 1m
+    block_escalation: [1m, 5m, 30m, 24h]
+    escalation_memory: 24h
+routes:
+  - method: POST
+    pattern: /export
+    requests: 5
+    window: 1m
+    shadow: true
+  - method: POST
+    pattern: /bulk
+    cost: 10
+  - method: GET
+    pattern: /reports/{id}
+    concurrency: {limit: 2, lease: 10m}
+allow:
+  ips: [10.0.0.0/8, 127.0.0.1]
+  tokens: [internal]
+deny:
+  tokens: [abuser]
+combined: true
+shadow: true
+pair:
+  requests: 20
+  window: 1m
+ipv6_prefix: 56
+`
+	base := RateLimiterConfig{IPv4Prefix: 32, IPv6Prefix: 64, TokenRules: map[string]domain.RateLimitRule{
+		"stale": {Requests: 1, Window: time.Second},
+	}}
+
+	cfg, err := parseRules([]byte(content), base)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantIP := domain.RateLimitRule{
+		Requests:      10,
+		Window:        time.Second,
+		BlockDuration: 5 * time.Minute,
+		Tiers:         []domain.Tier{{Requests: 1000, Window: time.Hour}},
+	}
+	if !reflect.DeepEqual(cfg.IPRule, wantIP) {
+		t.Fatalf("unexpected ip rule: %+v", cfg.IPRule)
+	}
+	wantDefault := domain.RateLimitRule{Algorithm: domain.AlgorithmTokenBucket, RefillRate: 2.5, Burst: 20}
+	if !reflect.DeepEqual(cfg.DefaultTokenRule, wantDefault) {
+		t.Fatalf("unexpected default token rule: %+v", cfg.DefaultTokenRule)
+	}
+	if len(cfg.TokenRules) != 1 || cfg.TokenRules["abc123"].Window != time.Minute {
+		t.Fatalf("expected file tokens to replace env tokens, got %+v", cfg.TokenRules)
+	}
+	wantEscalation := []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 24 * time.Hour}
+	if rule := cfg.TokenRules["abc123"]; !reflect.DeepEqual(rule.Escalation, wantEscalation) || rule.EscalationMemory != 24*time.Hour {
+		t.Fatalf("unexpected block escalation: %v memory=%v", rule.Escalation, rule.EscalationMemory)
+	}
+	wantRoute := domain.RouteRule{Method: "POST", Pattern: "/export", Rule: domain.RateLimitRule{Requests: 5, Window: time.Minute, Shadow: true}}
+	if len(cfg.RouteRules) != 3 || !reflect.DeepEqual(cfg.RouteRules[0], wantRoute) {
+		t.Fatalf("unexpected route rules: %+v", cfg.RouteRules)
+	}
+	if bulk := cfg.RouteRules[1]; bulk.Cost != 10 || !bulk.Rule.IsZero() {
+		t.Fatalf("expected cost-only route rule, got %+v", bulk)
+	}
+	wantConcurrency := domain.ConcurrencyRule{Limit: 2, Lease: 10 * time.Minute}
+	if reports := cfg.RouteRules[2]; reports.Concurrency != wantConcurrency || !reports.Rule.IsZero() {
+		t.Fatalf("expected concurrency-only route rule, got %+v", reports)
+	}
+	if !cfg.Combined || cfg.PairRule.Requests != 20 {
+		t.Fatalf("expected combined mode with pair rule, got combined=%v pair=%+v", cfg.Combined, cfg.PairRule)
+	}
+	if !cfg.Shadow {
+		t.Fatal("expected global shadow mode")
+	}
+	wantAllow := domain.AccessList{
+		Prefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("127.0.0.1/32")},
+		Tokens:   []string{"internal"},
+	}
+	if !reflect.DeepEqual(cfg.AllowList, wantAllow) {
+		t.Fatalf("unexpected allow list: %+v", cfg.AllowList)
+	}
+	if !reflect.DeepEqual(cfg.DenyList.Tokens, []string{"abuser"}) || len(cfg.DenyList.Prefixes) != 0 {
+		t.Fatalf("unexpected deny list: %+v", cfg.DenyList)
+	}
+	if cfg.IPv4Prefix != 32 || cfg.IPv6Prefix != 56 {
+		t.Fatalf("unexpected prefixes: v4=%d v6=%d", cfg.IPv4Prefix, cfg.IPv6Prefix)
+	}
+}
+
+func TestParseRules_AcceptsJSON(t *testing.T) {
+	content := `{"ip": {"requests": 3, "window": "10s"}, "tokens": {"t": {"requests": 1, "window": "1s"}}}`
+
+	cfg, err := parseRules([]byte(content), RateLimiterConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IPRule.Requests != 3 || cfg.IPRule.Window != 10*time.Second {
+		t.Fatalf("unexpected ip rule: %+v", cfg.IPRule)
+	}
+}
+
+func TestParseRules_CalendarPeriods(t *testing.T) {
+	content := `
+ip: {requests: 10, window: 1s, tiers: [{requests: 500, period: day}]}
+tokens:
+  plan: {requests: 10000, period: month, time_zone: America/Sao_Paulo}
+`
+	cfg, err := parseRules([]byte(content), RateLimiterConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tiers := cfg.IPRule.Tiers; len(tiers) != 1 || tiers[0] != (domain.Tier{Requests: 500, Period: domain.PeriodDay}) {
+		t.Fatalf("unexpected ip tiers: %+v", tiers)
+	}
+	plan := cfg.TokenRules["plan"]
+	if plan.Period != domain.PeriodMonth || plan.Window != 0 || plan.TimeZone().String() != "America/Sao_Paulo" {
+		t.Fatalf("unexpected calendar rule: %+v", plan)
+	}
+}
+
+func TestParseRules_MaxDelay(t *testing.T) {
+	cfg, err := parseRules([]byte("ip: {algorithm: gcra, requests: 10, window: 1s, max_delay: 250ms}"), RateLimiterConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IPRule.MaxDelay != 250*time.Millisecond {
+		t.Fatalf("unexpected max delay: %v", cfg.IPRule.MaxDelay)
+	}
+}
+
+func TestParseRules_RejectsInvalidFiles(t *testing.T) {
+	tests := map[string]string{
+		"missing ip rule":        "tokens: {}",
+		"unknown field":          "ip: {requests: 1, window: 1s, limit: 3}",
+		"invalid duration":       "ip: {requests: 1, window: soon}",
+		"invalid rule":           "ip: {requests: 1, window: 1s}\ntokens: {t: {algorithm: token_bucket}}",
+		"route without pattern":  "ip: {requests: 1, window: 1s}\nroutes: [{method: GET, requests: 1, window: 1s}]",
+		"invalid allow list ip":  "ip: {requests: 1, window: 1s}\nallow: {ips: [10.0.0.256]}",
+		"concurrency no lease":   "ip: {requests: 1, window: 1s}\nroutes: [{pattern: /x, concurrency: {limit: 1}}]",
+		"escalation no memory":   "ip: {requests: 1, window: 1s, block_escalation: [1m, 5m]}",
+		"unknown time zone":      "ip: {requests: 1, period: day, time_zone: Mars/Olympus}",
+		"period and window":      "ip: {requests: 1, window: 1s, period: day}",
+		"unknown period":         "ip: {requests: 1, period: fortnight}",
+		"period on gcra":         "ip: {algorithm: gcra, requests: 1, period: day, refill_rate: 1}",
+		"max delay without gcra": "ip: {requests: 1, window: 1s, max_delay: 1s}",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseRules([]byte(content), RateLimiterConfig{}); err == nil {
+				t.Fatalf("expected error for %q", content)
+			}
+		})
+	}
+}
+
+func TestWatchRulesFile_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	writeFile(t, path, "ip: {requests: 1, window: 1s}")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	applied := make(chan RateLimiterConfig, 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		WatchRulesFile(ctx, RateLimiterConfig{RulesFile: path, RulesReloadInterval: 10 * time.Millisecond},
+			func(cfg RateLimiterConfig) error {
+				applied <- cfg
+				return nil
+			})
+	}()
+
+	// Invalid content is ignored; the next valid version is applied.
+	writeFile(t, path, "ip: {requests: -1, window: 1s}")
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, path, "ip: {requests: 7, window: 1s}")
+
+	select {
+	case cfg := <-applied:
+		if cfg.IPRule.Requests != 7 {
+			t.Fatalf("expected reloaded rule with 7 requests, got %+v", cfg.IPRule)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("rules file was not reloaded")
+	}
+
+	cancel()
+	<-done
+	if len(applied) != 0 {
+		t.Fatalf("expected a single reload, got %d more", len(applied))
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(content)+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write rules file: %v", err)
+	}
+}
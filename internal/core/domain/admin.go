@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// IdentifierState descreve o estado atual de um identificador em todas as regras, a
+// global e as de cada rota.
+type IdentifierState struct {
+	Identifier     string
+	IdentifierType IdentifierType
+	Counters       []CounterState
+	Blocks         []BlockState
+}
+
+// CounterState é um contador de janela fixa do identificador. Route fica vazio para a
+// regra global e contém "MÉTODO padrão" nas regras por rota.
+type CounterState struct {
+	Route string
+	Key   string
+	Count int64
+	TTL   time.Duration
+}
+
+// BlockState é um bloqueio ativo de um identificador.
+type BlockState struct {
+	Identifier     string
+	IdentifierType IdentifierType
+	Route          string
+	TTL            time.Duration
+}
@@ -4,8 +4,23 @@ import "errors"
 
 var (
 	ErrBlocked = errors.New("identifier is blocked")
+	// ErrConcurrencyLimit indica que o identificador já ocupa todas as vagas de concorrência.
+	ErrConcurrencyLimit = errors.New("too many concurrent requests")
+	// ErrDenied indica uma requisição recusada pela lista de bloqueio, sem contagem.
+	ErrDenied = errors.New("identifier is denied")
+	// ErrUnavailable indica que o storage falhou e a política de falha recusa a requisição.
+	ErrUnavailable = errors.New("rate limiter is unavailable")
+	// ErrInvalidRequest indica uma requisição que não pode ser avaliada, como uma sem IP
+	// cujo token não tem regra ou uma com custo negativo.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrInvalidIdentifier indica um tipo de identificador desconhecido ou um identificador vazio.
+	ErrInvalidIdentifier = errors.New("invalid identifier")
 )
 
 func IsBlockedError(err error) bool {
 	return errors.Is(err, ErrBlocked)
 }
+
+func IsDeniedError(err error) bool {
+	return errors.Is(err, ErrDenied)
+}
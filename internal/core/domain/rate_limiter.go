@@ -1,22 +1,459 @@
 // Package domain concentra entidades e estruturas centrais do rate limiter.
 package domain
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"time"
+)
+
+// Algorithm identifica a estratégia de limitação aplicada por uma regra.
+type Algorithm string
+
+const (
+	// AlgorithmFixedWindow conta requisições em janelas fixas e é o padrão quando nada é informado.
+	AlgorithmFixedWindow Algorithm = "fixed_window"
+	// AlgorithmTokenBucket repõe tokens continuamente e permite rajadas até a capacidade do bucket.
+	AlgorithmTokenBucket Algorithm = "token_bucket"
+	// AlgorithmSlidingLog registra o instante de cada requisição e conta exatamente as da última janela.
+	AlgorithmSlidingLog Algorithm = "sliding_log"
+	// AlgorithmSlidingWindow aproxima a janela deslizante ponderando o contador da janela anterior.
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+	// AlgorithmGCRA (generic cell rate algorithm) guarda apenas o "theoretical arrival time"
+	// de cada identificador e calcula tempos de espera exatos.
+	AlgorithmGCRA Algorithm = "gcra"
+)
+
+// Period alinha um limite de janela fixa ao calendário: o contador recomeça exatamente
+// na virada da hora, do dia, da semana (segunda-feira) ou do mês.
+type Period string
+
+const (
+	PeriodHour  Period = "hour"
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+)
+
+// Validate aceita os períodos conhecidos e o valor vazio, que indica janela móvel.
+func (p Period) Validate() error {
+	switch p {
+	case "", PeriodHour, PeriodDay, PeriodWeek, PeriodMonth:
+		return nil
+	default:
+		return fmt.Errorf("unknown period %q", p)
+	}
+}
+
+// Bounds devolve o início e o fim do período que contém t, no fuso de t.
+func (p Period) Bounds(t time.Time) (time.Time, time.Time) {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch p {
+	case PeriodHour:
+		// Subtrair os minutos locais respeita fusos com deslocamento fracionário e as
+		// horas repetidas na saída do horário de verão.
+		start := t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+		return start, start.Add(time.Hour)
+	case PeriodDay:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	case PeriodWeek:
+		d -= (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+7, 0, 0, 0, 0, loc)
+	case PeriodMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc), time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+	default:
+		return t, t
+	}
+}
+
+// nominal é a duração usual do período, usada apenas para descrever o limite.
+func (p Period) nominal() time.Duration {
+	switch p {
+	case PeriodHour:
+		return time.Hour
+	case PeriodDay:
+		return 24 * time.Hour
+	case PeriodWeek:
+		return 7 * 24 * time.Hour
+	case PeriodMonth:
+		return 30 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
 
 type RateLimitRule struct {
-	Requests      int
-	Window        time.Duration
+	Algorithm Algorithm
+	Requests  int
+	Window    time.Duration
+	// BlockDuration só é aplicado atomicamente com a contagem na janela fixa. Nos demais
+	// algoritmos, o bloqueio é consultado e gravado em chamadas separadas, e requisições
+	// simultâneas à negação que o grava ainda podem ser avaliadas pelo limite.
 	BlockDuration time.Duration
+	// Period substitui Window por um período de calendário no fuso Location (UTC quando
+	// nil). Disponível apenas na janela fixa; Location também vale para os Tiers.
+	Period   Period
+	Location *time.Location
+	// RefillRate (tokens por segundo) e Burst (capacidade) configuram o token bucket e o GCRA.
+	// Quando zerados, são derivados de Requests/Window e Requests.
+	RefillRate float64
+	Burst      int
+	// MaxDelay, no GCRA, troca a negação por espera: a requisição que caberia no limite
+	// dentro desse prazo é permitida com Decision.Delay e reserva a vez dela, suavizando
+	// o tráfego como um leaky bucket. Esperas maiores continuam sendo negadas.
+	MaxDelay time.Duration
+	// Tiers lista limites adicionais verificados junto com Requests/Window, como 1000
+	// requisições por hora além de 10 por segundo. Disponível apenas na janela fixa.
+	Tiers []Tier
+	// Escalation substitui BlockDuration para reincidentes: a n-ésima violação dentro de
+	// EscalationMemory bloqueia por Escalation[n-1], e a última duração se repete.
+	// Negações simultâneas, antes de o bloqueio ser gravado, contam cada uma como violação.
+	Escalation       []time.Duration
+	EscalationMemory time.Duration
+	// Shadow conta e bloqueia normalmente, mas nunca nega a requisição: a negação que
+	// ocorreria é apenas registrada, para avaliar uma regra antes de aplicá-la.
+	Shadow bool
+}
+
+// PenaltyBlock devolve a duração do bloqueio do nível de penalidade informado (a partir
+// de 1). Sem escalonamento, é sempre BlockDuration.
+func (r RateLimitRule) PenaltyBlock(level int) time.Duration {
+	if len(r.Escalation) == 0 {
+		return r.BlockDuration
+	}
+	return r.Escalation[min(max(level, 1), len(r.Escalation))-1]
+}
+
+// Tier é um par de limite e janela de uma regra de janela fixa. Period, quando
+// preenchido, substitui Window.
+type Tier struct {
+	Requests int
+	Window   time.Duration
+	Period   Period
+}
+
+// Span devolve a janela do tier ou, em períodos de calendário, a duração nominal do
+// período (30 dias no mês).
+func (t Tier) Span() time.Duration {
+	if t.Period != "" {
+		return t.Period.nominal()
+	}
+	return t.Window
+}
+
+// Limits devolve o limite principal (Requests/Window ou Period) seguido dos Tiers adicionais.
+func (r RateLimitRule) Limits() []Tier {
+	return append([]Tier{{Requests: r.Requests, Window: r.Window, Period: r.Period}}, r.Tiers...)
+}
+
+// TimeZone devolve o fuso dos períodos de calendário da regra.
+func (r RateLimitRule) TimeZone() *time.Location {
+	if r.Location == nil {
+		return time.UTC
+	}
+	return r.Location
+}
+
+// IsZero indica se nenhum campo da regra foi preenchido.
+func (r RateLimitRule) IsZero() bool {
+	return reflect.ValueOf(r).IsZero()
+}
+
+// RateAndBurst devolve a taxa (requisições por segundo) e a capacidade de rajada efetivas.
+func (r RateLimitRule) RateAndBurst() (float64, int) {
+	rate, burst := r.RefillRate, r.Burst
+	if rate <= 0 && r.Requests > 0 && r.Window > 0 {
+		rate = float64(r.Requests) / r.Window.Seconds()
+	}
+	if burst <= 0 {
+		burst = r.Requests
+	}
+	return rate, burst
+}
+
+// Limit devolve a quantidade máxima de requisições aceitas de uma vez pela regra:
+// a capacidade de rajada nos algoritmos baseados em taxa e Requests nos demais.
+func (r RateLimitRule) Limit() int64 {
+	switch r.Algorithm {
+	case AlgorithmTokenBucket, AlgorithmGCRA:
+		_, burst := r.RateAndBurst()
+		return int64(burst)
+	default:
+		return int64(r.Requests)
+	}
+}
+
+// Capacity devolve o maior custo que uma requisição pode ter para caber na regra: o
+// menor limite entre os tiers na janela fixa e nas janelas deslizantes, a capacidade de
+// rajada no token bucket e, no GCRA, a rajada somada às vezes que cabem em MaxDelay.
+func (r RateLimitRule) Capacity() int64 {
+	switch r.Algorithm {
+	case AlgorithmTokenBucket:
+		return r.Limit()
+	case AlgorithmGCRA:
+		rate, burst := r.RateAndBurst()
+		return int64(burst) + int64(r.MaxDelay.Seconds()*rate)
+	default:
+		capacity := int64(r.Requests)
+		for _, tier := range r.Tiers {
+			capacity = min(capacity, int64(tier.Requests))
+		}
+		return capacity
+	}
+}
+
+// Enabled indica se a regra possui parâmetros suficientes para ser aplicada.
+func (r RateLimitRule) Enabled() bool {
+	return r.Validate() == nil
+}
+
+// Validate verifica se a regra é consistente com o algoritmo escolhido.
+func (r RateLimitRule) Validate() error {
+	if r.Period != "" && r.Algorithm != "" && r.Algorithm != AlgorithmFixedWindow {
+		return fmt.Errorf("periods are not supported by the %s algorithm", r.Algorithm)
+	}
+	switch r.Algorithm {
+	case "", AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingWindow:
+		if err := validateTier(Tier{Requests: r.Requests, Window: r.Window, Period: r.Period}); err != nil {
+			return err
+		}
+	case AlgorithmTokenBucket, AlgorithmGCRA:
+		rate, burst := r.RateAndBurst()
+		if rate <= 0 || burst <= 0 {
+			return errors.New("refill rate and burst must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown algorithm %q", r.Algorithm)
+	}
+	if r.BlockDuration < 0 {
+		return errors.New("block duration must not be negative")
+	}
+	if r.MaxDelay < 0 {
+		return errors.New("max delay must not be negative")
+	}
+	if r.MaxDelay > 0 && r.Algorithm != AlgorithmGCRA {
+		return fmt.Errorf("max delay is only supported by the %s algorithm", AlgorithmGCRA)
+	}
+	if err := r.validateEscalation(); err != nil {
+		return err
+	}
+	return r.validateTiers()
+}
+
+func (r RateLimitRule) validateEscalation() error {
+	if len(r.Escalation) == 0 {
+		if r.EscalationMemory != 0 {
+			return errors.New("escalation memory requires block escalation")
+		}
+		return nil
+	}
+	for _, block := range r.Escalation {
+		if block <= 0 {
+			return errors.New("block escalation durations must be positive")
+		}
+	}
+	if r.EscalationMemory <= 0 {
+		return errors.New("escalation memory must be positive")
+	}
+	return nil
+}
+
+func (r RateLimitRule) validateTiers() error {
+	if len(r.Tiers) == 0 {
+		return nil
+	}
+	if r.Algorithm != "" && r.Algorithm != AlgorithmFixedWindow {
+		return fmt.Errorf("tiers are not supported by the %s algorithm", r.Algorithm)
+	}
+	windows := make(map[time.Duration]bool, len(r.Tiers)+1)
+	periods := make(map[Period]bool, len(r.Tiers)+1)
+	for _, tier := range r.Limits() {
+		if err := validateTier(tier); err != nil {
+			return fmt.Errorf("tier: %w", err)
+		}
+		if tier.Period != "" {
+			if periods[tier.Period] {
+				return fmt.Errorf("duplicate tier period %s", tier.Period)
+			}
+			periods[tier.Period] = true
+			continue
+		}
+		if windows[tier.Window] {
+			return fmt.Errorf("duplicate tier window %s", tier.Window)
+		}
+		windows[tier.Window] = true
+	}
+	return nil
+}
+
+// validateTier exige um limite positivo e exatamente um entre janela e período.
+func validateTier(t Tier) error {
+	if err := t.Period.Validate(); err != nil {
+		return err
+	}
+	switch {
+	case t.Window > 0 && t.Period != "":
+		return errors.New("window and period are mutually exclusive")
+	case t.Requests <= 0 || (t.Window <= 0 && t.Period == ""):
+		return errors.New("requests and window must be positive")
+	}
+	return nil
+}
+
+// IdentifierType indica a qual dimensão da requisição o limite foi aplicado.
+type IdentifierType string
+
+const (
+	IdentifierIP    IdentifierType = "ip"
+	IdentifierToken IdentifierType = "token"
+	// IdentifierPair limita a combinação de um token com um IP no modo combinado.
+	IdentifierPair IdentifierType = "token_ip"
+)
+
+// RouteRule aplica uma regra própria às requisições de um método e padrão de rota.
+// Method vazio ou "*" vale para qualquer método; Pattern segue o formato do chi,
+// como "/users/{id}".
+type RouteRule struct {
+	Method  string
+	Pattern string
+	// Rule, quando preenchida, substitui a regra global com contadores próprios.
+	Rule RateLimitRule
+	// Cost é quanto da cota cada requisição da rota consome quando a requisição não
+	// informa o próprio custo.
+	Cost int64
+	// Concurrency, quando preenchida, limita também as requisições em andamento.
+	Concurrency ConcurrencyRule
+}
+
+// ConcurrencyRule limita quantas requisições de um identificador podem estar em
+// andamento ao mesmo tempo.
+type ConcurrencyRule struct {
+	Limit int
+	// Lease é o prazo máximo de cada vaga. Vagas não devolvidas, como as de uma instância
+	// que caiu, são liberadas ao fim dele.
+	Lease time.Duration
+}
+
+// IsZero indica se a regra não foi configurada.
+func (r ConcurrencyRule) IsZero() bool {
+	return r == ConcurrencyRule{}
+}
+
+// Validate garante que a regra tem limite e prazo positivos.
+func (r ConcurrencyRule) Validate() error {
+	if r.Limit <= 0 {
+		return fmt.Errorf("concurrency limit must be positive")
+	}
+	if r.Lease <= 0 {
+		return fmt.Errorf("concurrency lease must be positive")
+	}
+	return nil
+}
+
+// Lease é uma vaga de concorrência obtida com Acquire e devolvida com Release. O valor
+// zero indica que nenhuma vaga foi ocupada.
+type Lease struct {
+	Key string
+	ID  string
+}
+
+// IsZero indica se nenhuma vaga foi ocupada.
+func (l Lease) IsZero() bool {
+	return l == Lease{}
+}
+
+// AccessList reúne IPs, faixas CIDR e tokens. IPs isolados são prefixos /32 ou /128.
+type AccessList struct {
+	Prefixes []netip.Prefix
+	Tokens   []string
+}
+
+// IsEmpty indica se a lista não tem nenhuma entrada.
+func (l AccessList) IsEmpty() bool {
+	return len(l.Prefixes) == 0 && len(l.Tokens) == 0
+}
+
+// Reason explica a origem de uma decisão.
+type Reason string
+
+const (
+	// ReasonLimit indica uma decisão tomada pela contagem das regras de limite.
+	ReasonLimit Reason = "limit"
+	// ReasonAllowList indica uma requisição isenta pela lista de permissão, sem contagem.
+	ReasonAllowList Reason = "allowlist"
+	// ReasonDenyList indica uma requisição recusada pela lista de bloqueio, sem contagem.
+	ReasonDenyList Reason = "denylist"
+	// ReasonStorageUnavailable indica uma decisão tomada pela política de falha porque o
+	// storage não respondeu.
+	ReasonStorageUnavailable Reason = "storage_unavailable"
+)
+
+// FailurePolicy define o que fazer com as requisições quando o storage falha.
+type FailurePolicy string
+
+const (
+	// FailClosed recusa as requisições. É o padrão.
+	FailClosed FailurePolicy = "closed"
+	// FailOpen permite as requisições sem limitá-las.
+	FailOpen FailurePolicy = "open"
+	// FailFallback passa a limitar com um storage em memória do processo. O desvio é
+	// feito pelo storage; se ainda assim houver falha, a requisição é recusada.
+	FailFallback FailurePolicy = "fallback"
+)
+
+func (p FailurePolicy) Validate() error {
+	switch p {
+	case "", FailClosed, FailOpen, FailFallback:
+		return nil
+	default:
+		return fmt.Errorf("unsupported failure policy %q", p)
+	}
 }
 
 type RateLimitRequest struct {
 	IP    string
 	Token string
+	// Method e Route (padrão da rota, não o caminho concreto) selecionam regras por rota.
+	Method string
+	Route  string
+	// Cost é quanto da cota a requisição consome; zero usa o custo da rota ou 1.
+	Cost int64
 }
 
 type Decision struct {
-	Allowed      bool
-	Identifier   string
-	AppliedRule  RateLimitRule
-	CurrentCount int64
+	Allowed        bool
+	Identifier     string
+	IdentifierType IdentifierType
+	AppliedRule    RateLimitRule
+	CurrentCount   int64
+	// Limit é a quantidade máxima de requisições (ou a capacidade de rajada) da regra aplicada.
+	Limit int64
+	// Remaining é a quantidade de requisições que ainda seriam aceitas imediatamente.
+	Remaining int64
+	// RetryAfter indica quanto tempo esperar até a próxima requisição ser aceita, quando negada.
+	RetryAfter time.Duration
+	// ResetAfter indica quanto tempo falta para o limite voltar ao estado inicial, e
+	// ResetAt o instante em que isso acontece; em períodos de calendário, a virada do
+	// período. ResetAt é zero nas decisões que não passam pelas regras.
+	ResetAfter time.Duration
+	ResetAt    time.Time
+	// Tier é o limite da janela fixa que negou a requisição ou, quando permitida, o que
+	// está mais perto de se esgotar. Limit, Remaining e ResetAfter se referem a ele.
+	Tier Tier
+	// Reason explica por que a decisão foi tomada.
+	Reason Reason
+	// PenaltyLevel é a quantidade de violações recentes do identificador, em regras com
+	// escalonamento de bloqueio. Só é preenchido em decisões negadas.
+	PenaltyLevel int
+	// Shadowed indica que a requisição seria negada, mas foi permitida pelo modo shadow.
+	Shadowed bool
+	// Delay é quanto a requisição permitida deve esperar antes de prosseguir, em regras
+	// com MaxDelay. A vez dela já está reservada.
+	Delay time.Duration
+	// Dimensions traz, no modo combinado, a decisão de cada dimensão avaliada, na ordem
+	// de avaliação; as posteriores a uma negação não são avaliadas.
+	Dimensions []Decision
 }
@@ -10,3 +10,20 @@ import (
 type RateLimiter interface {
 	Allow(ctx context.Context, req domain.RateLimitRequest) (domain.Decision, error)
 }
+
+// ConcurrencyLimiter controla quantas requisições de cada identificador estão em andamento.
+type ConcurrencyLimiter interface {
+	// Acquire ocupa uma vaga quando a rota tem regra de concorrência. Sem regra, devolve
+	// um Lease zerado; sem vagas, devolve domain.ErrConcurrencyLimit.
+	Acquire(ctx context.Context, req domain.RateLimitRequest) (domain.Lease, error)
+	// Release devolve a vaga ocupada por Acquire.
+	Release(ctx context.Context, lease domain.Lease) error
+}
+
+// LimiterAdmin expõe operações administrativas sobre o estado do limiter.
+type LimiterAdmin interface {
+	Inspect(ctx context.Context, identifierType domain.IdentifierType, identifier string) (domain.IdentifierState, error)
+	Unblock(ctx context.Context, identifierType domain.IdentifierType, identifier string) error
+	Reset(ctx context.Context, identifierType domain.IdentifierType, identifier string) error
+	ListBlocked(ctx context.Context) ([]domain.BlockState, error)
+}
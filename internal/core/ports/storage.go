@@ -3,11 +3,98 @@ package ports
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrStorageUnavailable é devolvido sem acessar o storage quando ele é considerado fora
+// do ar, como faz o circuit breaker.
+var ErrStorageUnavailable = errors.New("storage unavailable")
+
 type Storage interface {
+	// Increment soma 1 ao contador e devolve o novo valor. A expiração é definida apenas
+	// quando a chave é criada, de modo que a janela começa no primeiro incremento.
 	Increment(ctx context.Context, key string, window time.Duration) (int64, error)
+	// IncrementBy é o Increment que soma amount em vez de 1.
+	IncrementBy(ctx context.Context, key string, amount int64, window time.Duration) (int64, error)
 	IsBlocked(ctx context.Context, key string) (bool, error)
 	SetBlock(ctx context.Context, key string, duration time.Duration) error
+	// TTL devolve o tempo restante até a chave expirar: 0 quando ela não existe e um
+	// valor negativo quando ela não possui expiração.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Hit verifica o bloqueio e incrementa todos os contadores (definindo a expiração
+	// apenas no primeiro acesso de cada janela) em uma única operação atômica. Se algum
+	// contador fosse ultrapassar o limite, nenhum é incrementado e o bloqueio é aplicado.
+	// Enquanto bloqueado, os contadores não são incrementados. Cada contador recebe cost.
+	Hit(ctx context.Context, blockKey string, counters []Counter, block time.Duration, cost int64) (HitResult, error)
+	// TakeToken repõe o bucket de acordo com o tempo decorrido e tenta consumir cost
+	// tokens, de forma atômica. O relógio utilizado é o do próprio storage.
+	TakeToken(ctx context.Context, key string, rate float64, burst int, cost int64) (TokenBucketResult, error)
+	// TakeSlidingLog descarta registros mais antigos que a janela e registra cost entradas
+	// para a requisição atual caso ainda haja espaço dentro do limite.
+	TakeSlidingLog(ctx context.Context, key string, window time.Duration, limit int, cost int64) (SlidingWindowResult, error)
+	// TakeSlidingWindow estima a contagem da janela deslizante a partir do contador da
+	// janela atual e do anterior, somando cost ao atual caso a estimativa caiba no limite.
+	TakeSlidingWindow(ctx context.Context, key string, window time.Duration, limit int, cost int64) (SlidingWindowResult, error)
+	// Get devolve o valor inteiro armazenado na chave, ou 0 quando ela não existe.
+	Get(ctx context.Context, key string) (int64, error)
+	// CompareAndSwap grava value com o ttl informado somente se o valor atual for igual
+	// a old, de forma atômica. old igual a 0 exige que a chave não exista.
+	CompareAndSwap(ctx context.Context, key string, old, value int64, ttl time.Duration) (bool, error)
+	// AcquireSlot descarta as vagas com concessão vencida e, se restarem menos de limit,
+	// registra member com concessão de duração lease, de forma atômica.
+	AcquireSlot(ctx context.Context, key, member string, limit int, lease time.Duration) (SlotResult, error)
+	// ReleaseSlot devolve a vaga de member antes do fim da concessão.
+	ReleaseSlot(ctx context.Context, key, member string) error
+	// Delete remove as chaves informadas, ignorando as que não existem.
+	Delete(ctx context.Context, keys ...string) error
+	// Keys lista as chaves que correspondem ao padrão, em que "*" representa qualquer
+	// sequência de caracteres. Usado apenas em operações administrativas.
+	Keys(ctx context.Context, pattern string) ([]string, error)
+}
+
+// Counter é um contador de janela fixa avaliado por Hit.
+type Counter struct {
+	Key    string
+	Window time.Duration
+	Limit  int
+}
+
+// HitResult descreve o estado dos contadores e do bloqueio após um Hit.
+type HitResult struct {
+	// Counts e TTLs seguem a ordem dos contadores informados.
+	Counts []int64
+	TTLs   []time.Duration
+	// Exceeded é o índice do primeiro contador que negou a requisição, ou -1.
+	Exceeded int
+	// Blocked indica que o identificador já estava bloqueado ou acabou de ser bloqueado.
+	Blocked  bool
+	BlockTTL time.Duration
+}
+
+// TokenBucketResult descreve o estado do bucket após uma tentativa de consumo.
+type TokenBucketResult struct {
+	Allowed bool
+	// Tokens restantes no bucket após a operação.
+	Tokens float64
+	// RetryAfter indica quando haverá tokens suficientes caso a tentativa tenha sido negada.
+	RetryAfter time.Duration
+}
+
+// SlotResult descreve o conjunto de vagas após uma tentativa de ocupação.
+type SlotResult struct {
+	Acquired bool
+	// InUse é a quantidade de vagas ocupadas após a operação.
+	InUse int64
+}
+
+// SlidingWindowResult descreve o resultado das estratégias de janela deslizante.
+type SlidingWindowResult struct {
+	Allowed bool
+	// Count é a quantidade (exata ou estimada) de requisições na janela após a operação.
+	Count int64
+	// RetryAfter indica quando uma nova requisição caberia no limite caso a tentativa tenha sido negada.
+	RetryAfter time.Duration
+	// ResetAfter indica quando a janela deixará de conter qualquer requisição registrada.
+	ResetAfter time.Duration
 }
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+// accessList é a forma preparada de domain.AccessList, com os tokens indexados.
+type accessList struct {
+	prefixes []netip.Prefix
+	tokens   map[string]struct{}
+}
+
+func newAccessList(list domain.AccessList) (accessList, error) {
+	out := accessList{tokens: make(map[string]struct{}, len(list.Tokens))}
+	for _, prefix := range list.Prefixes {
+		if !prefix.IsValid() {
+			return accessList{}, fmt.Errorf("invalid prefix")
+		}
+		out.prefixes = append(out.prefixes, prefix.Masked())
+	}
+	for _, token := range list.Tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return accessList{}, fmt.Errorf("token must not be empty")
+		}
+		out.tokens[token] = struct{}{}
+	}
+	return out, nil
+}
+
+// match devolve o identificador da requisição presente na lista, verificando o token
+// antes do IP.
+func (l accessList) match(ip netip.Addr, token string) (domain.IdentifierType, string, bool) {
+	if token != "" {
+		if _, ok := l.tokens[token]; ok {
+			return domain.IdentifierToken, token, true
+		}
+	}
+	if ip.IsValid() {
+		for _, prefix := range l.prefixes {
+			if prefix.Contains(ip) {
+				return domain.IdentifierIP, ip.String(), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// checkAccessLists decide a requisição pelas listas, quando ela consta em alguma. A
+// lista de bloqueio é verificada primeiro, para que um token isento não libere um IP
+// banido, nem o contrário.
+func (cfg *Config) checkAccessLists(req domain.RateLimitRequest) (domain.Decision, bool) {
+	token := strings.TrimSpace(req.Token)
+	var ip netip.Addr
+	if addr, err := netip.ParseAddr(strings.TrimSpace(req.IP)); err == nil {
+		ip = addr.Unmap().WithZone("")
+	}
+
+	if identifierType, identifier, ok := cfg.deny.match(ip, token); ok {
+		return domain.Decision{Allowed: false, Identifier: identifier, IdentifierType: identifierType, Reason: domain.ReasonDenyList}, true
+	}
+	if identifierType, identifier, ok := cfg.allow.match(ip, token); ok {
+		return domain.Decision{Allowed: true, Identifier: identifier, IdentifierType: identifierType, Reason: domain.ReasonAllowList}, true
+	}
+	return domain.Decision{}, false
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+func TestRateLimiter_AccessLists(t *testing.T) {
+	service := newTestLimiter(t, failingStorage{}, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+		AllowList: domain.AccessList{
+			Prefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+			Tokens:   []string{"internal"},
+		},
+		DenyList: domain.AccessList{
+			Prefixes: []netip.Prefix{netip.MustParsePrefix("10.6.6.6/32")},
+			Tokens:   []string{"abuser"},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		req     domain.RateLimitRequest
+		allowed bool
+		reason  domain.Reason
+	}{
+		{name: "allowed cidr", req: domain.RateLimitRequest{IP: "10.1.2.3"}, allowed: true, reason: domain.ReasonAllowList},
+		{name: "allowed token", req: domain.RateLimitRequest{IP: "192.0.2.1", Token: "internal"}, allowed: true, reason: domain.ReasonAllowList},
+		{name: "ipv4-mapped address", req: domain.RateLimitRequest{IP: "::ffff:10.1.2.3"}, allowed: true, reason: domain.ReasonAllowList},
+		{name: "denied ip wins over allowed cidr", req: domain.RateLimitRequest{IP: "10.6.6.6"}, reason: domain.ReasonDenyList},
+		{name: "denied token wins over allowed ip", req: domain.RateLimitRequest{IP: "10.1.2.3", Token: "abuser"}, reason: domain.ReasonDenyList},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// failingStorage proves that listed requests never reach the storage.
+			decision, err := service.Allow(context.Background(), tt.req)
+			if tt.allowed && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.allowed && !domain.IsDeniedError(err) {
+				t.Fatalf("expected ErrDenied, got %v", err)
+			}
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Fatalf("unexpected decision: %+v", decision)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_UnlistedRequestsAreCounted(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+		AllowList:     domain.AccessList{Prefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+	})
+
+	decision, err := service.Allow(context.Background(), domain.RateLimitRequest{IP: "192.0.2.1"})
+	if err != nil || decision.Reason != domain.ReasonLimit {
+		t.Fatalf("expected a counted decision, got decision=%+v err=%v", decision, err)
+	}
+}
+
+func TestRateLimiter_RejectsEmptyListedToken(t *testing.T) {
+	_, err := NewRateLimiterService(newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+		DenyList:      domain.AccessList{Tokens: []string{" "}},
+	})
+	if err == nil {
+		t.Fatalf("expected error for empty token")
+	}
+}
+
+// failingStorage panics on any call, so tests using it prove the storage is never reached.
+type failingStorage struct {
+	ports.Storage
+}
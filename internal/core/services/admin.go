@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+var _ ports.LimiterAdmin = (*RateLimiterService)(nil)
+
+// algorithmSuffixes são os sufixos das chaves de estado dos algoritmos que não usam
+// o contador de janela fixa.
+var algorithmSuffixes = []string{":bucket", ":log", ":sliding", ":gcra"}
+
+// namespace identifica um conjunto de contadores: o global, com sufixo vazio, ou o de
+// uma regra por rota.
+type namespace struct {
+	route  string
+	suffix string
+}
+
+// Inspect devolve os contadores de janela fixa e os bloqueios ativos do identificador,
+// na regra global e em cada regra por rota. O estado dos demais algoritmos não é um
+// contador simples e não é listado.
+func (s *RateLimiterService) Inspect(ctx context.Context, identifierType domain.IdentifierType, identifier string) (domain.IdentifierState, error) {
+	cfg := s.config.Load()
+	identifier, err := cfg.adminIdentifier(identifierType, identifier)
+	if err != nil {
+		return domain.IdentifierState{}, err
+	}
+
+	state := domain.IdentifierState{
+		Identifier:     buildKeys("", identifierType, identifier).identifier,
+		IdentifierType: identifierType,
+	}
+	now := cfg.Clock()
+	for _, ns := range cfg.namespaces() {
+		keys := buildKeys(ns.suffix, identifierType, identifier)
+
+		for _, key := range cfg.counterKeys(keys, now) {
+			count, err := s.storage.Get(ctx, key)
+			if err != nil {
+				return domain.IdentifierState{}, err
+			}
+			if count == 0 {
+				continue
+			}
+			ttl, err := s.storage.TTL(ctx, key)
+			if err != nil {
+				return domain.IdentifierState{}, err
+			}
+			state.Counters = append(state.Counters, domain.CounterState{Route: ns.route, Key: key, Count: count, TTL: ttl})
+		}
+
+		block, ok, err := s.blockState(ctx, keys, ns.route)
+		if err != nil {
+			return domain.IdentifierState{}, err
+		}
+		if ok {
+			state.Blocks = append(state.Blocks, block)
+		}
+	}
+	return state, nil
+}
+
+// Unblock remove os bloqueios do identificador em todas as regras, junto com o
+// histórico de violações do escalonamento. Os contadores são mantidos; use Reset para
+// zerá-los.
+func (s *RateLimiterService) Unblock(ctx context.Context, identifierType domain.IdentifierType, identifier string) error {
+	cfg := s.config.Load()
+	identifier, err := cfg.adminIdentifier(identifierType, identifier)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, ns := range cfg.namespaces() {
+		resolved := buildKeys(ns.suffix, identifierType, identifier)
+		keys = append(keys, resolved.blockKey, resolved.counterKey+offencesSuffix)
+	}
+	return s.storage.Delete(ctx, keys...)
+}
+
+// Reset apaga o estado de todos os algoritmos do identificador em todas as regras,
+// sem remover bloqueios ativos. As vagas de concorrência também são liberadas, o que
+// corrige vagas presas antes do fim da concessão.
+func (s *RateLimiterService) Reset(ctx context.Context, identifierType domain.IdentifierType, identifier string) error {
+	cfg := s.config.Load()
+	identifier, err := cfg.adminIdentifier(identifierType, identifier)
+	if err != nil {
+		return err
+	}
+
+	now := cfg.Clock()
+	var keys []string
+	for _, ns := range cfg.namespaces() {
+		resolved := buildKeys(ns.suffix, identifierType, identifier)
+		keys = append(keys, cfg.counterKeys(resolved, now)...)
+		for _, suffix := range algorithmSuffixes {
+			keys = append(keys, resolved.counterKey+suffix)
+		}
+	}
+	for key, route := range cfg.routes {
+		if !route.Concurrency.IsZero() {
+			keys = append(keys, buildKeys(key.namespace(), identifierType, identifier).counterKey+concurrencySuffix)
+		}
+	}
+	return s.storage.Delete(ctx, keys...)
+}
+
+// ListBlocked lista os bloqueios ativos de todos os identificadores. Bloqueios de rotas
+// que não estão mais configuradas são ignorados, pois não afetam requisições.
+func (s *RateLimiterService) ListBlocked(ctx context.Context) ([]domain.BlockState, error) {
+	cfg := s.config.Load()
+
+	keys, err := s.storage.Keys(ctx, "ratelimit:*:block")
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := cfg.namespaces()
+	var blocks []domain.BlockState
+	for _, key := range keys {
+		ns, identifierType, identifier, ok := parseBlockKey(key, namespaces)
+		if !ok {
+			continue
+		}
+		block, ok, err := s.blockState(ctx, buildKeys(ns.suffix, identifierType, identifier), ns.route)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			blocks = append(blocks, block)
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].Route != blocks[j].Route {
+			return blocks[i].Route < blocks[j].Route
+		}
+		if blocks[i].IdentifierType != blocks[j].IdentifierType {
+			return blocks[i].IdentifierType < blocks[j].IdentifierType
+		}
+		return blocks[i].Identifier < blocks[j].Identifier
+	})
+	return blocks, nil
+}
+
+func (s *RateLimiterService) blockState(ctx context.Context, keys resolvedKeys, route string) (domain.BlockState, bool, error) {
+	blocked, err := s.storage.IsBlocked(ctx, keys.blockKey)
+	if err != nil || !blocked {
+		return domain.BlockState{}, false, err
+	}
+	ttl, err := s.storage.TTL(ctx, keys.blockKey)
+	if err != nil {
+		return domain.BlockState{}, false, err
+	}
+	return domain.BlockState{
+		Identifier:     keys.identifier,
+		IdentifierType: keys.identifierType,
+		Route:          route,
+		TTL:            ttl,
+	}, true, nil
+}
+
+// adminIdentifier valida o identificador e o normaliza como Allow faria, para que o
+// mesmo IP escrito de outra forma encontre as mesmas chaves.
+func (cfg *Config) adminIdentifier(identifierType domain.IdentifierType, identifier string) (string, error) {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return "", fmt.Errorf("%w: identifier is required", domain.ErrInvalidIdentifier)
+	}
+
+	switch identifierType {
+	case domain.IdentifierIP:
+		return cfg.ipIdentifier(identifier), nil
+	case domain.IdentifierToken:
+		return identifier, nil
+	case domain.IdentifierPair:
+		token, ip, ok := strings.Cut(identifier, "|")
+		if !ok || token == "" || ip == "" {
+			return "", fmt.Errorf("%w: pair identifier must be token|ip", domain.ErrInvalidIdentifier)
+		}
+		return token + "|" + cfg.ipIdentifier(ip), nil
+	default:
+		return "", fmt.Errorf("%w: unknown identifier type %q", domain.ErrInvalidIdentifier, identifierType)
+	}
+}
+
+// namespaces devolve o namespace global seguido dos namespaces das rotas com regra própria.
+func (cfg *Config) namespaces() []namespace {
+	namespaces := []namespace{{}}
+	for key, route := range cfg.routes {
+		if route.Rule.IsZero() {
+			continue
+		}
+		namespaces = append(namespaces, namespace{route: key.String(), suffix: key.namespace()})
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].route < namespaces[j].route })
+	return namespaces
+}
+
+// counterKeys devolve a chave do contador principal seguida das chaves dos tiers de
+// todas as regras configuradas, pois a chave de um tier é derivada da sua janela ou,
+// nos períodos de calendário, do período atual.
+func (cfg *Config) counterKeys(keys resolvedKeys, now time.Time) []string {
+	rules := []domain.RateLimitRule{cfg.DefaultIPRule, cfg.DefaultTokenRule, cfg.PairRule}
+	for _, rule := range cfg.TokenRules {
+		rules = append(rules, rule)
+	}
+	for _, route := range cfg.routes {
+		rules = append(rules, route.Rule)
+	}
+
+	seen := map[string]bool{keys.counterKey: true}
+	var tiers []string
+	for _, rule := range rules {
+		for i, tier := range rule.Limits() {
+			key := tierCounter(keys.counterKey, i, tier, now, rule.TimeZone()).Key
+			if !seen[key] {
+				seen[key] = true
+				tiers = append(tiers, key)
+			}
+		}
+	}
+	sort.Strings(tiers)
+	return append([]string{keys.counterKey}, tiers...)
+}
+
+// parseBlockKey faz o caminho inverso de buildKeys para uma chave de bloqueio.
+func parseBlockKey(key string, namespaces []namespace) (namespace, domain.IdentifierType, string, bool) {
+	rest, ok := strings.CutPrefix(key, "ratelimit:{")
+	if !ok {
+		return namespace{}, "", "", false
+	}
+	if rest, ok = strings.CutSuffix(rest, ":block"); !ok {
+		return namespace{}, "", "", false
+	}
+
+	for _, ns := range namespaces {
+		tagged, ok := strings.CutSuffix(rest, "}"+ns.suffix)
+		// O sufixo vazio casa com qualquer chave; as de rotas não configuradas são
+		// descartadas aqui.
+		if !ok || (ns.suffix == "" && strings.Contains(tagged, "}:route:")) {
+			continue
+		}
+		identifierType, identifier, ok := strings.Cut(tagged, ":")
+		if !ok {
+			return namespace{}, "", "", false
+		}
+		return ns, domain.IdentifierType(identifierType), identifier, true
+	}
+	return namespace{}, "", "", false
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestAdmin_InspectUnblockAndReset(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Requests:      2,
+			Window:        time.Minute,
+			BlockDuration: time.Hour,
+			Tiers:         []domain.Tier{{Requests: 100, Window: time.Hour}},
+		},
+		RouteRules: []domain.RouteRule{{
+			Method:  "POST",
+			Pattern: "/export",
+			Rule:    domain.RateLimitRule{Requests: 1, Window: time.Minute, BlockDuration: time.Hour},
+		}},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, _ = service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1"})
+	}
+	_, _ = service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Method: "POST", Route: "/export"})
+
+	// The IP is looked up in a different textual form than the one used by Allow.
+	state, err := service.Inspect(ctx, domain.IdentifierIP, "::ffff:10.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.Identifier != "10.0.0.1" {
+		t.Fatalf("expected normalised identifier, got %q", state.Identifier)
+	}
+	if len(state.Counters) != 3 {
+		t.Fatalf("expected global, tier and route counters, got %+v", state.Counters)
+	}
+	if c := state.Counters[0]; c.Route != "" || c.Count != 2 || c.TTL <= 0 {
+		t.Fatalf("unexpected global counter: %+v", c)
+	}
+	if c := state.Counters[2]; c.Route != "POST /export" || c.Count != 1 {
+		t.Fatalf("unexpected route counter: %+v", c)
+	}
+	if len(state.Blocks) != 1 || state.Blocks[0].Route != "" || state.Blocks[0].TTL <= 0 {
+		t.Fatalf("expected a global block, got %+v", state.Blocks)
+	}
+
+	if err := service.Unblock(ctx, domain.IdentifierIP, "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	state, _ = service.Inspect(ctx, domain.IdentifierIP, "10.0.0.1")
+	if len(state.Blocks) != 0 || len(state.Counters) != 3 {
+		t.Fatalf("expected unblock to keep counters, got %+v", state)
+	}
+
+	if err := service.Reset(ctx, domain.IdentifierIP, "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	state, _ = service.Inspect(ctx, domain.IdentifierIP, "10.0.0.1")
+	if len(state.Counters) != 0 {
+		t.Fatalf("expected counters to be reset, got %+v", state.Counters)
+	}
+	if decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1"}); err != nil || decision.Remaining != 1 {
+		t.Fatalf("expected a fresh quota after reset, got decision=%+v err=%v", decision, err)
+	}
+}
+
+func TestAdmin_ListBlocked(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute, BlockDuration: time.Hour},
+		TokenRules: map[string]domain.RateLimitRule{
+			"abc": {Requests: 1, Window: time.Minute, BlockDuration: time.Hour},
+		},
+		RouteRules: []domain.RouteRule{{
+			Pattern: "/users/{id}",
+			Rule:    domain.RateLimitRule{Requests: 1, Window: time.Minute, BlockDuration: time.Hour},
+		}},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, _ = service.Allow(ctx, domain.RateLimitRequest{IP: "2001:db8::1"})
+		_, _ = service.Allow(ctx, domain.RateLimitRequest{Token: "abc", Method: "GET", Route: "/users/{id}"})
+	}
+	// Blocks of routes that are no longer configured do not affect requests.
+	_ = storage.SetBlock(ctx, "ratelimit:{ip:1.1.1.1}:route:GET /old:block", time.Hour)
+
+	blocks, err := service.ListBlocked(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected two blocks, got %+v", blocks)
+	}
+	if b := blocks[0]; b.IdentifierType != domain.IdentifierIP || b.Identifier != "2001:db8::/64" || b.Route != "" {
+		t.Fatalf("unexpected ip block: %+v", b)
+	}
+	if b := blocks[1]; b.IdentifierType != domain.IdentifierToken || b.Identifier != "abc" || b.Route != "* /users/{id}" {
+		t.Fatalf("unexpected route block: %+v", b)
+	}
+}
+
+func TestAdmin_RejectsInvalidIdentifiers(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Second},
+	})
+
+	tests := map[string]struct {
+		identifierType domain.IdentifierType
+		identifier     string
+	}{
+		"empty identifier": {domain.IdentifierIP, " "},
+		"unknown type":     {"user", "x"},
+		"malformed pair":   {domain.IdentifierPair, "abc"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := service.Unblock(context.Background(), tc.identifierType, tc.identifier)
+			if !errors.Is(err, domain.ErrInvalidIdentifier) {
+				t.Fatalf("expected ErrInvalidIdentifier, got %v", err)
+			}
+		})
+	}
+}
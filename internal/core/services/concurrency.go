@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+var _ ports.ConcurrencyLimiter = (*RateLimiterService)(nil)
+
+// concurrencySuffix é o sufixo da chave com as vagas de concorrência da rota.
+const concurrencySuffix = ":concurrency"
+
+// Acquire ocupa uma vaga de concorrência da rota para o identificador da requisição.
+// Rotas sem regra de concorrência e requisições na lista de permissão não ocupam vaga.
+// Falhas do storage seguem a política de falha, como em Allow.
+func (s *RateLimiterService) Acquire(ctx context.Context, req domain.RateLimitRequest) (domain.Lease, error) {
+	cfg := s.config.Load()
+
+	key, route, ok := cfg.matchRoute(req)
+	if !ok || route.Concurrency.IsZero() {
+		return domain.Lease{}, nil
+	}
+	if decision, ok := cfg.checkAccessLists(req); ok {
+		if !decision.Allowed {
+			return domain.Lease{}, domain.ErrDenied
+		}
+		return domain.Lease{}, nil
+	}
+
+	keys, err := cfg.concurrencyKeys(req, key)
+	if err != nil {
+		return domain.Lease{}, err
+	}
+	id, err := leaseID()
+	if err != nil {
+		return domain.Lease{}, err
+	}
+
+	lease := domain.Lease{Key: keys.counterKey + concurrencySuffix, ID: id}
+	result, err := s.storage.AcquireSlot(ctx, lease.Key, lease.ID, route.Concurrency.Limit, route.Concurrency.Lease)
+	if err != nil {
+		_, err = s.storageFailure(cfg, dimension{keys: keys}, err)
+		return domain.Lease{}, err
+	}
+	if !result.Acquired {
+		return domain.Lease{}, domain.ErrConcurrencyLimit
+	}
+	return lease, nil
+}
+
+// Release devolve a vaga obtida com Acquire. Um Lease zerado é ignorado.
+func (s *RateLimiterService) Release(ctx context.Context, lease domain.Lease) error {
+	if lease.IsZero() {
+		return nil
+	}
+	return s.storage.ReleaseSlot(ctx, lease.Key, lease.ID)
+}
+
+// concurrencyKeys escolhe o identificador cujas vagas são contadas: o token, quando ele
+// tem regra, ou o IP, como no modo padrão.
+func (cfg *Config) concurrencyKeys(req domain.RateLimitRequest, route routeKey) (resolvedKeys, error) {
+	token := strings.TrimSpace(req.Token)
+	if _, ok := cfg.tokenRule(token); ok {
+		return buildKeys(route.namespace(), domain.IdentifierToken, token), nil
+	}
+	ip := strings.TrimSpace(req.IP)
+	if ip == "" {
+		return resolvedKeys{}, fmt.Errorf("%w: ip address is required when token has no override", domain.ErrInvalidRequest)
+	}
+	return buildKeys(route.namespace(), domain.IdentifierIP, cfg.ipIdentifier(ip)), nil
+}
+
+func leaseID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate lease id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestConcurrency_AcquireAndRelease(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 100, Window: time.Minute},
+		TokenRules:    map[string]domain.RateLimitRule{"abc": {Requests: 100, Window: time.Minute}},
+		RouteRules: []domain.RouteRule{{
+			Method:      "POST",
+			Pattern:     "/export",
+			Concurrency: domain.ConcurrencyRule{Limit: 2, Lease: time.Minute},
+		}},
+	})
+	ctx := context.Background()
+	export := domain.RateLimitRequest{IP: "10.0.0.1", Method: "POST", Route: "/export"}
+
+	first, err := service.Acquire(ctx, export)
+	if err != nil || first.IsZero() {
+		t.Fatalf("expected a lease, got %+v err=%v", first, err)
+	}
+	if _, err := service.Acquire(ctx, export); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.Acquire(ctx, export); !errors.Is(err, domain.ErrConcurrencyLimit) {
+		t.Fatalf("expected ErrConcurrencyLimit, got %v", err)
+	}
+
+	// Slots are counted per identifier.
+	if _, err := service.Acquire(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Token: "abc", Method: "POST", Route: "/export"}); err != nil {
+		t.Fatalf("expected token to have its own slots, got %v", err)
+	}
+
+	if err := service.Release(ctx, first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.Acquire(ctx, export); err != nil {
+		t.Fatalf("expected released slot to be available, got %v", err)
+	}
+
+	if err := service.Reset(ctx, domain.IdentifierIP, "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.Acquire(ctx, export); err != nil {
+		t.Fatalf("expected reset to free the slots, got %v", err)
+	}
+}
+
+func TestConcurrency_SkipsRoutesWithoutRuleAndAllowListed(t *testing.T) {
+	service := newTestLimiter(t, failingStorage{}, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+		AllowList:     domain.AccessList{Tokens: []string{"internal"}},
+		RouteRules: []domain.RouteRule{{
+			Pattern:     "/export",
+			Concurrency: domain.ConcurrencyRule{Limit: 1, Lease: time.Minute},
+		}},
+	})
+	ctx := context.Background()
+
+	for _, req := range []domain.RateLimitRequest{
+		{IP: "10.0.0.1", Method: "GET", Route: "/other"},
+		{IP: "10.0.0.1", Token: "internal", Method: "GET", Route: "/export"},
+	} {
+		lease, err := service.Acquire(ctx, req)
+		if err != nil || !lease.IsZero() {
+			t.Fatalf("expected no lease for %+v, got %+v err=%v", req, lease, err)
+		}
+	}
+	if err := service.Release(ctx, domain.Lease{}); err != nil {
+		t.Fatalf("expected zero lease release to be a no-op, got %v", err)
+	}
+}
+
+func TestConcurrency_FollowsFailurePolicy(t *testing.T) {
+	for policy, wantErr := range map[domain.FailurePolicy]bool{
+		domain.FailClosed: true,
+		domain.FailOpen:   false,
+	} {
+		service := newTestLimiter(t, unavailableStorage{}, Config{
+			DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+			FailurePolicy: policy,
+			RouteRules: []domain.RouteRule{{
+				Pattern:     "/export",
+				Concurrency: domain.ConcurrencyRule{Limit: 1, Lease: time.Minute},
+			}},
+		})
+
+		lease, err := service.Acquire(context.Background(), domain.RateLimitRequest{IP: "10.0.0.1", Route: "/export"})
+		if gotErr := errors.Is(err, domain.ErrUnavailable); gotErr != wantErr || !lease.IsZero() {
+			t.Fatalf("%s: unexpected result lease=%+v err=%v", policy, lease, err)
+		}
+	}
+}
+
+func TestConcurrency_RejectsRequestsWithoutIdentifier(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+		RouteRules: []domain.RouteRule{{
+			Pattern:     "/export",
+			Concurrency: domain.ConcurrencyRule{Limit: 1, Lease: time.Minute},
+		}},
+	})
+
+	lease, err := service.Acquire(context.Background(), domain.RateLimitRequest{Token: "unknown", Route: "/export"})
+	if !errors.Is(err, domain.ErrInvalidRequest) || !lease.IsZero() {
+		t.Fatalf("expected ErrInvalidRequest, got lease=%+v err=%v", lease, err)
+	}
+}
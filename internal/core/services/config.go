@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+// Config agrega os limites utilizados pelo serviço de rate limiting.
+type Config struct {
+	DefaultIPRule    domain.RateLimitRule
+	DefaultTokenRule domain.RateLimitRule
+	TokenRules       map[string]domain.RateLimitRule
+	// Combined exige que requisições com token passem também pelo limite do IP, em vez
+	// de aplicar apenas um dos dois.
+	Combined bool
+	// PairRule, opcional, limita cada combinação de token e IP no modo combinado.
+	PairRule domain.RateLimitRule
+	// RouteRules substituem as regras globais nas rotas correspondentes, cada uma com
+	// seus próprios contadores. Rotas sem regra seguem usando as regras globais.
+	RouteRules []domain.RouteRule
+	// IPv4Prefix e IPv6Prefix definem o tamanho da sub-rede que compartilha o limite
+	// por IP. Zerados, usam /32 para IPv4 e /64 para IPv6.
+	IPv4Prefix int
+	IPv6Prefix int
+	// AllowList isenta IPs, faixas e tokens do rate limiting; DenyList os recusa sempre.
+	// Ambas são verificadas antes de qualquer contagem, e a DenyList tem precedência.
+	AllowList domain.AccessList
+	DenyList  domain.AccessList
+	// FailurePolicy define a decisão quando o storage falha; o padrão é recusar.
+	FailurePolicy domain.FailurePolicy
+	// Shadow coloca todas as regras em modo shadow, como se cada uma tivesse Shadow.
+	// As listas de bloqueio e os limites de concorrência continuam sendo aplicados.
+	Shadow bool
+	// Clock permite injetar o relógio usado pelos algoritmos calculados no serviço (GCRA)
+	// e pelo intervalo entre os logs de falha do storage.
+	Clock func() time.Time
+
+	routes map[routeKey]domain.RouteRule
+	allow  accessList
+	deny   accessList
+}
+
+type routeKey struct {
+	method  string
+	pattern string
+}
+
+func newRouteKey(method, pattern string) routeKey {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = anyMethod
+	}
+	return routeKey{method: method, pattern: strings.TrimSpace(pattern)}
+}
+
+func (k routeKey) String() string {
+	return k.method + " " + k.pattern
+}
+
+// namespace é o sufixo que separa os contadores da rota dos globais.
+func (k routeKey) namespace() string {
+	return ":route:" + k.String()
+}
+
+const (
+	defaultIPv4Prefix = 32
+	defaultIPv6Prefix = 64
+	anyMethod         = "*"
+)
+
+// prepare valida a configuração e preenche os valores padrão.
+func (cfg Config) prepare() (Config, error) {
+	if err := cfg.DefaultIPRule.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid default IP rule: %w", err)
+	}
+	if !cfg.DefaultTokenRule.IsZero() {
+		if err := cfg.DefaultTokenRule.Validate(); err != nil {
+			return Config{}, fmt.Errorf("invalid default token rule: %w", err)
+		}
+	}
+	if !cfg.PairRule.IsZero() {
+		if err := cfg.PairRule.Validate(); err != nil {
+			return Config{}, fmt.Errorf("invalid token and IP pair rule: %w", err)
+		}
+	}
+	for token, rule := range cfg.TokenRules {
+		if err := rule.Validate(); err != nil {
+			return Config{}, fmt.Errorf("invalid rule for token %s: %w", token, err)
+		}
+	}
+	cfg.routes = make(map[routeKey]domain.RouteRule, len(cfg.RouteRules))
+	for _, route := range cfg.RouteRules {
+		key := newRouteKey(route.Method, route.Pattern)
+		if key.pattern == "" {
+			return Config{}, fmt.Errorf("route rule for method %s has an empty pattern", key.method)
+		}
+		if _, exists := cfg.routes[key]; exists {
+			return Config{}, fmt.Errorf("duplicate rule for route %s %s", key.method, key.pattern)
+		}
+		if route.Cost < 0 {
+			return Config{}, fmt.Errorf("cost for route %s %s must not be negative", key.method, key.pattern)
+		}
+		if route.Rule.IsZero() && route.Cost == 0 && route.Concurrency.IsZero() {
+			return Config{}, fmt.Errorf("route %s %s must define a rule, a cost or a concurrency limit", key.method, key.pattern)
+		}
+		if !route.Rule.IsZero() {
+			if err := route.Rule.Validate(); err != nil {
+				return Config{}, fmt.Errorf("invalid rule for route %s %s: %w", key.method, key.pattern, err)
+			}
+		}
+		if !route.Concurrency.IsZero() {
+			if err := route.Concurrency.Validate(); err != nil {
+				return Config{}, fmt.Errorf("invalid concurrency rule for route %s %s: %w", key.method, key.pattern, err)
+			}
+		}
+		cfg.routes[key] = route
+	}
+	if err := cfg.FailurePolicy.Validate(); err != nil {
+		return Config{}, err
+	}
+	var err error
+	if cfg.allow, err = newAccessList(cfg.AllowList); err != nil {
+		return Config{}, fmt.Errorf("invalid allow list: %w", err)
+	}
+	if cfg.deny, err = newAccessList(cfg.DenyList); err != nil {
+		return Config{}, fmt.Errorf("invalid deny list: %w", err)
+	}
+	if cfg.TokenRules == nil {
+		cfg.TokenRules = make(map[string]domain.RateLimitRule)
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+	if cfg.IPv4Prefix == 0 {
+		cfg.IPv4Prefix = defaultIPv4Prefix
+	}
+	if cfg.IPv6Prefix == 0 {
+		cfg.IPv6Prefix = defaultIPv6Prefix
+	}
+	if cfg.IPv4Prefix < 1 || cfg.IPv4Prefix > 32 {
+		return Config{}, fmt.Errorf("IPv4 prefix must be between 1 and 32")
+	}
+	if cfg.IPv6Prefix < 1 || cfg.IPv6Prefix > 128 {
+		return Config{}, fmt.Errorf("IPv6 prefix must be between 1 and 128")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+// offencesSuffix é o sufixo da chave que conta as violações recentes do identificador.
+const offencesSuffix = ":offences"
+
+// offenceMaxAttempts limita as tentativas de compare-and-swap ao registrar uma violação.
+const offenceMaxAttempts = 10
+
+var errOffenceContention = errors.New("escalation: too many concurrent offences")
+
+// penalize aplica o bloqueio de uma nova violação. Com escalonamento, registra a
+// violação e bloqueia pela duração do nível alcançado; sem ele, usa BlockDuration.
+func penalize(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule) (time.Duration, int, error) {
+	level := 0
+	if len(rule.Escalation) > 0 {
+		var err error
+		if level, err = recordOffence(ctx, storage, keys.counterKey+offencesSuffix, rule.EscalationMemory); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	block := rule.PenaltyBlock(level)
+	if block <= 0 {
+		return 0, level, nil
+	}
+	if err := storage.SetBlock(ctx, keys.blockKey, block); err != nil {
+		return 0, 0, err
+	}
+	return block, level, nil
+}
+
+// recordOffence soma uma violação e renova a memória, para que o histórico só expire
+// depois de memory sem novas violações. Devolve o novo nível.
+func recordOffence(ctx context.Context, storage ports.Storage, key string, memory time.Duration) (int, error) {
+	for attempt := 0; attempt < offenceMaxAttempts; attempt++ {
+		offences, err := storage.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		swapped, err := storage.CompareAndSwap(ctx, key, offences, offences+1, memory)
+		if err != nil {
+			return 0, err
+		}
+		if swapped {
+			return int(offences + 1), nil
+		}
+	}
+	return 0, errOffenceContention
+}
+
+// penaltyLevel lê o nível de um identificador que já está bloqueado.
+func penaltyLevel(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule) (int, error) {
+	if len(rule.Escalation) == 0 {
+		return 0, nil
+	}
+	offences, err := storage.Get(ctx, keys.counterKey+offencesSuffix)
+	return int(offences), err
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/memory"
+	"github.com/JeanGrijp/rate-limiter/internal/clocktest"
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+)
+
+func TestEscalation_RepeatOffendersAreBlockedLonger(t *testing.T) {
+	for _, algorithm := range []domain.Algorithm{domain.AlgorithmFixedWindow, domain.AlgorithmSlidingLog} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			clock := clocktest.New()
+			storage := memory.New(memory.Config{Clock: clock.Now})
+			t.Cleanup(func() { _ = storage.Close() })
+			service := newTestLimiter(t, storage, Config{
+				DefaultIPRule: domain.RateLimitRule{
+					Algorithm:        algorithm,
+					Requests:         1,
+					Window:           time.Second,
+					BlockDuration:    time.Hour,
+					Escalation:       []time.Duration{time.Minute, 5 * time.Minute},
+					EscalationMemory: time.Hour,
+				},
+				Clock: clock.Now,
+			})
+			ctx := context.Background()
+			req := domain.RateLimitRequest{IP: "10.0.0.1"}
+
+			// Each round uses the quota, violates it and waits out the block.
+			for _, want := range []struct {
+				level int
+				block time.Duration
+			}{{1, time.Minute}, {2, 5 * time.Minute}, {3, 5 * time.Minute}} {
+				if decision, err := service.Allow(ctx, req); err != nil || !decision.Allowed {
+					t.Fatalf("level %d: expected first request to be allowed, got %+v err=%v", want.level, decision, err)
+				}
+				decision, _ := service.Allow(ctx, req)
+				if decision.Allowed || decision.PenaltyLevel != want.level || decision.RetryAfter != want.block {
+					t.Fatalf("expected level %d blocked for %v, got level %d retry %v", want.level, want.block, decision.PenaltyLevel, decision.RetryAfter)
+				}
+
+				// Requests while blocked keep reporting the level without escalating it.
+				clock.Advance(want.block - time.Second)
+				if decision, _ := service.Allow(ctx, req); decision.Allowed || decision.PenaltyLevel != want.level {
+					t.Fatalf("expected level %d while blocked, got %+v", want.level, decision)
+				}
+				clock.Advance(time.Second)
+			}
+		})
+	}
+}
+
+func TestEscalation_OffencesAreForgottenAfterMemory(t *testing.T) {
+	clock := clocktest.New()
+	storage := memory.New(memory.Config{Clock: clock.Now})
+	t.Cleanup(func() { _ = storage.Close() })
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Requests:         1,
+			Window:           time.Second,
+			Escalation:       []time.Duration{time.Minute, time.Hour},
+			EscalationMemory: 10 * time.Minute,
+		},
+		Clock: clock.Now,
+	})
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "10.0.0.1"}
+
+	_, _ = service.Allow(ctx, req)
+	_, _ = service.Allow(ctx, req)
+	clock.Advance(10 * time.Minute)
+
+	_, _ = service.Allow(ctx, req)
+	if decision, _ := service.Allow(ctx, req); decision.PenaltyLevel != 1 || decision.RetryAfter != time.Minute {
+		t.Fatalf("expected the history to be forgotten, got level %d retry %v", decision.PenaltyLevel, decision.RetryAfter)
+	}
+
+	// Unblocking also forgives the history.
+	if err := service.Unblock(ctx, domain.IdentifierIP, "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(time.Second)
+	_, _ = service.Allow(ctx, req)
+	if decision, _ := service.Allow(ctx, req); decision.PenaltyLevel != 1 {
+		t.Fatalf("expected unblock to reset the level, got %d", decision.PenaltyLevel)
+	}
+}
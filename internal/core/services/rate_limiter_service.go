@@ -3,100 +3,327 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
+	"net/netip"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
 	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
 )
 
-// Config agrega os limites utilizados pelo serviço de rate limiting.
-type Config struct {
-	DefaultIPRule    domain.RateLimitRule
-	DefaultTokenRule domain.RateLimitRule
-	TokenRules       map[string]domain.RateLimitRule
-}
-
 // RateLimiterService implementa a lógica central de rate limiting.
 type RateLimiterService struct {
 	storage ports.Storage
-	config  Config
+	config  atomic.Pointer[Config]
+
+	// lastFailureLog guarda, em nanossegundos Unix, o último log de falha do storage
+	// no fail-open, para que uma indisponibilidade não gere um log por requisição.
+	lastFailureLog atomic.Int64
 }
 
+// failureLogInterval é o intervalo mínimo entre dois logs de falha do storage no fail-open.
+const failureLogInterval = 10 * time.Second
+
 // NewRateLimiterService cria uma nova instância do serviço.
 func NewRateLimiterService(storage ports.Storage, cfg Config) (*RateLimiterService, error) {
 	if storage == nil {
 		return nil, fmt.Errorf("storage is required")
 	}
-	if cfg.DefaultIPRule.Requests <= 0 || cfg.DefaultIPRule.Window <= 0 {
-		return nil, fmt.Errorf("default IP rule must have positive values")
-	}
-	if cfg.TokenRules == nil {
-		cfg.TokenRules = make(map[string]domain.RateLimitRule)
+	cfg, err := cfg.prepare()
+	if err != nil {
+		return nil, err
 	}
 
-	return &RateLimiterService{storage: storage, config: cfg}, nil
+	s := &RateLimiterService{storage: storage}
+	s.config.Store(&cfg)
+	return s, nil
+}
+
+// UpdateConfig substitui atomicamente as regras em uso, sem interromper requisições em
+// andamento. Uma configuração inválida é rejeitada e a atual é mantida.
+func (s *RateLimiterService) UpdateConfig(cfg Config) error {
+	cfg, err := cfg.prepare()
+	if err != nil {
+		return err
+	}
+	s.config.Store(&cfg)
+	return nil
 }
 
 // Allow avalia se a requisição pode prosseguir de acordo com as regras configuradas.
+// Requisições nas listas de permissão ou bloqueio são decididas sem acessar o storage.
+// No modo combinado cada dimensão (IP, token e par token+IP) é avaliada em sequência e
+// a avaliação para na primeira negação: as dimensões anteriores já contaram a requisição,
+// e as seguintes não são cobradas. Negações de regras em modo shadow são apenas
+// registradas, e a avaliação segue como se a dimensão tivesse permitido. Uma requisição
+// permitida com espera (Decision.Delay) espera pela dimensão mais lenta.
 func (s *RateLimiterService) Allow(ctx context.Context, req domain.RateLimitRequest) (domain.Decision, error) {
-	rule, keys, err := s.resolveRule(req)
-	if err != nil {
-		return domain.Decision{}, err
+	cfg := s.config.Load()
+
+	if decision, ok := cfg.checkAccessLists(req); ok {
+		if !decision.Allowed {
+			return decision, domain.ErrDenied
+		}
+		return decision, nil
 	}
 
-	blocked, err := s.storage.IsBlocked(ctx, keys.blockKey)
+	dims, err := cfg.resolveDimensions(req)
 	if err != nil {
 		return domain.Decision{}, err
 	}
-	if blocked {
-		return domain.Decision{Allowed: false, Identifier: keys.identifier, AppliedRule: rule}, domain.ErrBlocked
+
+	decisions := make([]domain.Decision, 0, len(dims))
+	for _, dim := range dims {
+		decision, err := s.evaluate(ctx, cfg, dim)
+		if err != nil {
+			return s.storageFailure(cfg, dim, err)
+		}
+		shadow := cfg.Shadow || dim.rule.Shadow
+		if !decision.Allowed && shadow {
+			log.Printf("rate limit shadow mode: would deny %s %s (limit %d, retry after %s)",
+				decision.IdentifierType, decision.Identifier, decision.Limit, decision.RetryAfter)
+			decision.Allowed = true
+			decision.Shadowed = true
+		}
+		if shadow {
+			// Uma regra em modo shadow não afeta o tráfego, nem mesmo atrasando-o.
+			decision.Delay = 0
+		}
+		decisions = append(decisions, decision)
+		if !decision.Allowed {
+			break
+		}
 	}
 
-	currentCount, err := s.storage.Increment(ctx, keys.counterKey, rule.Window)
+	decision := decisive(decisions)
+	if len(dims) > 1 {
+		decision.Dimensions = decisions
+		if decision.Allowed {
+			for _, d := range decisions {
+				decision.Shadowed = decision.Shadowed || d.Shadowed
+				decision.Delay = max(decision.Delay, d.Delay)
+			}
+		}
+	}
+	if !decision.Allowed {
+		return decision, domain.ErrBlocked
+	}
+	return decision, nil
+}
+
+// storageFailure aplica a política de falha. No fail-open a requisição é permitida e o
+// erro registrado em log, no máximo uma vez a cada failureLogInterval; nas demais ela é
+// recusada com domain.ErrUnavailable.
+func (s *RateLimiterService) storageFailure(cfg *Config, dim dimension, err error) (domain.Decision, error) {
+	decision := domain.Decision{
+		Allowed:        cfg.FailurePolicy == domain.FailOpen,
+		Identifier:     dim.keys.identifier,
+		IdentifierType: dim.keys.identifierType,
+		Reason:         domain.ReasonStorageUnavailable,
+	}
+	if decision.Allowed {
+		now := cfg.Clock().UnixNano()
+		last := s.lastFailureLog.Load()
+		if now-last >= int64(failureLogInterval) && s.lastFailureLog.CompareAndSwap(last, now) {
+			log.Printf("rate limiter storage failed, allowing requests (%s %s): %v",
+				dim.keys.identifierType, dim.keys.identifier, err)
+		}
+		return decision, nil
+	}
+	return decision, fmt.Errorf("%w: %w", domain.ErrUnavailable, err)
+}
+
+func (s *RateLimiterService) evaluate(ctx context.Context, cfg *Config, dim dimension) (domain.Decision, error) {
+	strat, ok := strategies[dim.rule.Algorithm]
+	if !ok {
+		return domain.Decision{}, fmt.Errorf("unsupported algorithm %q", dim.rule.Algorithm)
+	}
+
+	now := cfg.Clock()
+	result, err := strat.take(ctx, s.storage, dim.keys, dim.rule, now, dim.cost)
 	if err != nil {
 		return domain.Decision{}, err
 	}
+	decision := result.decision(result.allowed, dim.keys, dim.rule)
+	decision.ResetAt = now.Add(decision.ResetAfter)
+	return decision, nil
+}
 
-	if int(currentCount) > rule.Requests {
-		if setErr := s.storage.SetBlock(ctx, keys.blockKey, rule.BlockDuration); setErr != nil {
-			return domain.Decision{}, setErr
+// decisive escolhe a decisão que representa a requisição: a dimensão que negou ou,
+// quando todas permitiram, a que tem menos requisições restantes.
+func decisive(decisions []domain.Decision) domain.Decision {
+	last := decisions[len(decisions)-1]
+	if !last.Allowed {
+		return last
+	}
+	chosen := decisions[0]
+	for _, d := range decisions[1:] {
+		if d.Remaining < chosen.Remaining {
+			chosen = d
 		}
-		return domain.Decision{Allowed: false, Identifier: keys.identifier, AppliedRule: rule, CurrentCount: currentCount}, domain.ErrBlocked
 	}
-
-	return domain.Decision{Allowed: true, Identifier: keys.identifier, AppliedRule: rule, CurrentCount: currentCount}, nil
+	return chosen
 }
 
 type resolvedKeys struct {
-	counterKey string
-	blockKey   string
-	identifier string
+	counterKey     string
+	blockKey       string
+	identifier     string
+	identifierType domain.IdentifierType
+}
+
+// dimension é um identificador da requisição acompanhado da regra que o limita e do
+// custo que a requisição consome.
+type dimension struct {
+	rule domain.RateLimitRule
+	keys resolvedKeys
+	cost int64
 }
 
-func (s *RateLimiterService) resolveRule(req domain.RateLimitRequest) (domain.RateLimitRule, resolvedKeys, error) {
+// resolveDimensions escolhe os identificadores a limitar. No modo padrão é o token,
+// quando ele tem regra, ou o IP; no modo combinado são o IP, o token e, se houver
+// regra para isso, o par token+IP.
+func (cfg *Config) resolveDimensions(req domain.RateLimitRequest) ([]dimension, error) {
 	token := strings.TrimSpace(req.Token)
-	if token != "" {
-		if rule, ok := s.config.TokenRules[token]; ok {
-			return rule, buildKeys("token", token), nil
+	ip := strings.TrimSpace(req.IP)
+	tokenRule, hasTokenRule := cfg.tokenRule(token)
+
+	key, route, hasRoute := cfg.matchRoute(req)
+	cost, err := requestCost(req, route)
+	if err != nil {
+		return nil, err
+	}
+
+	// Uma regra de rota substitui a regra global em um namespace separado; rotas que
+	// definem apenas o custo continuam usando a regra e os contadores globais.
+	dimensionFor := func(rule domain.RateLimitRule, identifierType domain.IdentifierType, identifier string) dimension {
+		namespace := ""
+		if hasRoute && !route.Rule.IsZero() {
+			rule = route.Rule
+			namespace = key.namespace()
+		}
+		return dimension{rule: rule, keys: buildKeys(namespace, identifierType, identifier), cost: cost}
+	}
+
+	if !cfg.Combined && hasTokenRule {
+		return cfg.checkCapacity([]dimension{dimensionFor(tokenRule, domain.IdentifierToken, token)})
+	}
+
+	var dims []dimension
+	var ipID string
+	if ip != "" {
+		ipID = cfg.ipIdentifier(ip)
+		dims = append(dims, dimensionFor(cfg.DefaultIPRule, domain.IdentifierIP, ipID))
+	}
+	if cfg.Combined && hasTokenRule {
+		dims = append(dims, dimensionFor(tokenRule, domain.IdentifierToken, token))
+		if ip != "" && !cfg.PairRule.IsZero() {
+			dims = append(dims, dimensionFor(cfg.PairRule, domain.IdentifierPair, token+"|"+ipID))
 		}
-		if s.config.DefaultTokenRule.Requests > 0 && s.config.DefaultTokenRule.Window > 0 {
-			return s.config.DefaultTokenRule, buildKeys("token", token), nil
+	}
+	if len(dims) == 0 {
+		return nil, fmt.Errorf("%w: ip address is required when token has no override", domain.ErrInvalidRequest)
+	}
+	return cfg.checkCapacity(dims)
+}
+
+// checkCapacity recusa custos que nunca caberiam na regra de alguma dimensão. Sem isso
+// o storage devolveria um RetryAfter impossível de cumprir e, na janela fixa, bloquearia
+// o identificador por uma única requisição. Regras em modo shadow não são verificadas,
+// já que nunca negam.
+func (cfg *Config) checkCapacity(dims []dimension) ([]dimension, error) {
+	for _, dim := range dims {
+		if cfg.Shadow || dim.rule.Shadow {
+			continue
+		}
+		if capacity := dim.rule.Capacity(); dim.cost > capacity {
+			return nil, fmt.Errorf("%w: request cost %d exceeds the %s rule capacity of %d",
+				domain.ErrInvalidRequest, dim.cost, dim.keys.identifierType, capacity)
 		}
 	}
+	return dims, nil
+}
 
-	ip := strings.TrimSpace(req.IP)
-	if ip == "" {
-		return domain.RateLimitRule{}, resolvedKeys{}, fmt.Errorf("ip address is required when token has no override")
+func (cfg *Config) tokenRule(token string) (domain.RateLimitRule, bool) {
+	if token == "" {
+		return domain.RateLimitRule{}, false
+	}
+	if rule, ok := cfg.TokenRules[token]; ok {
+		return rule, true
 	}
+	if cfg.DefaultTokenRule.Enabled() {
+		return cfg.DefaultTokenRule, true
+	}
+	return domain.RateLimitRule{}, false
+}
+
+// requestCost usa o custo informado na requisição, depois o da rota e, na falta de
+// ambos, 1.
+func requestCost(req domain.RateLimitRequest, route domain.RouteRule) (int64, error) {
+	switch {
+	case req.Cost < 0:
+		return 0, fmt.Errorf("%w: request cost must not be negative", domain.ErrInvalidRequest)
+	case req.Cost > 0:
+		return req.Cost, nil
+	case route.Cost > 0:
+		return route.Cost, nil
+	default:
+		return 1, nil
+	}
+}
+
+// matchRoute procura uma regra para o método exato e, depois, para qualquer método.
+func (cfg *Config) matchRoute(req domain.RateLimitRequest) (routeKey, domain.RouteRule, bool) {
+	if len(cfg.routes) == 0 || req.Route == "" {
+		return routeKey{}, domain.RouteRule{}, false
+	}
+	for _, key := range []routeKey{newRouteKey(req.Method, req.Route), newRouteKey(anyMethod, req.Route)} {
+		if route, ok := cfg.routes[key]; ok {
+			return key, route, true
+		}
+	}
+	return routeKey{}, domain.RouteRule{}, false
+}
 
-	return s.config.DefaultIPRule, buildKeys("ip", ip), nil
+// ipIdentifier normaliza o IP com net/netip e o agrega ao prefixo configurado, para
+// que formas textuais equivalentes e endereços da mesma sub-rede compartilhem o limite.
+// Valores que não são IPs válidos são usados como vieram.
+func (cfg *Config) ipIdentifier(raw string) string {
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return raw
+	}
+	addr = addr.Unmap().WithZone("")
+
+	bits := cfg.IPv6Prefix
+	if addr.Is4() {
+		bits = cfg.IPv4Prefix
+	}
+	if bits >= addr.BitLen() {
+		return addr.String()
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
 }
 
-func buildKeys(prefix, identifier string) resolvedKeys {
+// buildKeys monta as chaves do identificador. namespace separa os contadores de regras
+// por rota (":route:POST /export") dos globais, que usam namespace vazio. O tipo e o
+// identificador ficam em uma hash tag do Redis Cluster, para que todas as chaves do
+// identificador caiam no mesmo slot e possam ser usadas juntas nos scripts atômicos.
+// A tag vem antes do namespace porque padrões de rota também podem conter chaves.
+func buildKeys(namespace string, identifierType domain.IdentifierType, identifier string) resolvedKeys {
 	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	counterKey := fmt.Sprintf("ratelimit:{%s:%s}%s", identifierType, identifier, namespace)
 	return resolvedKeys{
-		counterKey: fmt.Sprintf("ratelimit:%s:%s", prefix, identifier),
-		blockKey:   fmt.Sprintf("ratelimit:%s:%s:block", prefix, identifier),
-		identifier: identifier,
+		counterKey:     counterKey,
+		blockKey:       counterKey + ":block",
+		identifier:     identifier,
+		identifierType: identifierType,
 	}
 }
@@ -1,15 +1,25 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/JeanGrijp/rate-limiter/internal/adapters/storage/memory"
+	"github.com/JeanGrijp/rate-limiter/internal/clocktest"
 	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
 )
 
 func TestRateLimiter_AllowsWithinIPLimit(t *testing.T) {
-	storage := newMockStorage()
+	storage := newTestStorage(t)
 	service := newTestLimiter(t, storage, Config{
 		DefaultIPRule: domain.RateLimitRule{
 			Requests:      3,
@@ -32,7 +42,7 @@ func TestRateLimiter_AllowsWithinIPLimit(t *testing.T) {
 }
 
 func TestRateLimiter_BlocksAfterExceedingIPLimit(t *testing.T) {
-	storage := newMockStorage()
+	storage := newTestStorage(t)
 	service := newTestLimiter(t, storage, Config{
 		DefaultIPRule: domain.RateLimitRule{
 			Requests:      2,
@@ -64,8 +74,133 @@ func TestRateLimiter_BlocksAfterExceedingIPLimit(t *testing.T) {
 	}
 }
 
+func TestRateLimiter_DecisionReportsQuotaAndTimings(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Requests:      2,
+			Window:        time.Minute,
+			BlockDuration: 5 * time.Minute,
+		},
+	})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "10.0.0.3"}
+
+	decision, err := service.Allow(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decision.Limit != 2 || decision.Remaining != 1 {
+		t.Fatalf("expected limit 2 and 1 remaining, got %+v", decision)
+	}
+	if decision.ResetAfter <= 0 || decision.ResetAfter > time.Minute {
+		t.Fatalf("expected reset within the window, got %v", decision.ResetAfter)
+	}
+
+	_, _ = service.Allow(ctx, req)
+	decision, err = service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) {
+		t.Fatalf("expected blocked error, got %v", err)
+	}
+	if decision.Remaining != 0 || decision.RetryAfter != 5*time.Minute {
+		t.Fatalf("expected no quota and retry after the block duration, got %+v", decision)
+	}
+}
+
+func TestRateLimiter_ConcurrentRequestsRespectLimit(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Requests:      50,
+			Window:        time.Minute,
+			BlockDuration: time.Minute,
+		},
+	})
+
+	ctx := context.Background()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.2"})
+			if err != nil && !domain.IsBlockedError(err) {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if decision.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 50 {
+		t.Fatalf("expected exactly 50 allowed requests, got %d", allowed)
+	}
+}
+
+func TestRateLimiter_AggregatesIPv6ByPrefix(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Requests:      2,
+			Window:        time.Minute,
+			BlockDuration: time.Minute,
+		},
+	})
+
+	ctx := context.Background()
+
+	// Different addresses (and textual forms) inside the same /64 share one counter.
+	for _, ip := range []string{"2001:db8:1:2::1", "2001:DB8:1:2:0:0:0:ffff"} {
+		decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: ip})
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", ip, err)
+		}
+		if decision.Identifier != "2001:db8:1:2::/64" {
+			t.Fatalf("expected /64 identifier, got %s", decision.Identifier)
+		}
+	}
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "2001:db8:1:2:abcd::9"}); !domain.IsBlockedError(err) {
+		t.Fatalf("expected the /64 to be blocked, got %v", err)
+	}
+
+	// Another /64 keeps its own quota.
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "2001:db8:1:3::1"}); err != nil {
+		t.Fatalf("expected a different /64 to be allowed, got %v", err)
+	}
+}
+
+func TestRateLimiter_NormalisesIPv4(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 10, Window: time.Minute},
+		IPv4Prefix:    24,
+	})
+
+	ctx := context.Background()
+
+	for ip, want := range map[string]string{
+		"::ffff:192.0.2.10": "192.0.2.0/24",
+		"192.0.2.200":       "192.0.2.0/24",
+	} {
+		decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: ip})
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", ip, err)
+		}
+		if decision.Identifier != want {
+			t.Fatalf("expected %s to map to %s, got %s", ip, want, decision.Identifier)
+		}
+	}
+}
+
 func TestRateLimiter_UsesTokenOverride(t *testing.T) {
-	storage := newMockStorage()
+	storage := newTestStorage(t)
 	tokenRule := domain.RateLimitRule{
 		Requests:      5,
 		Window:        time.Second,
@@ -93,14 +228,14 @@ func TestRateLimiter_UsesTokenOverride(t *testing.T) {
 		if !decision.Allowed {
 			t.Fatalf("expected token request %d to be allowed", i+1)
 		}
-		if decision.AppliedRule != tokenRule {
+		if !reflect.DeepEqual(decision.AppliedRule, tokenRule) {
 			t.Fatalf("expected token rule to be applied, got %+v", decision.AppliedRule)
 		}
 	}
 }
 
 func TestRateLimiter_DefaultTokenRule(t *testing.T) {
-	storage := newMockStorage()
+	storage := newTestStorage(t)
 	defaultTokenRule := domain.RateLimitRule{
 		Requests:      2,
 		Window:        time.Second,
@@ -134,8 +269,800 @@ func TestRateLimiter_DefaultTokenRule(t *testing.T) {
 	}
 }
 
+func TestRateLimiter_TokenBucketAllowsBurstThenDenies(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Algorithm:  domain.AlgorithmTokenBucket,
+			RefillRate: 0.001,
+			Burst:      3,
+		},
+	})
+
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "192.0.2.1"}); err != nil || !decision.Allowed {
+			t.Fatalf("expected burst request %d to be allowed, decision=%+v err=%v", i+1, decision, err)
+		}
+	}
+
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "192.0.2.1"}); !domain.IsBlockedError(err) {
+		t.Fatalf("expected empty bucket to deny, got %v", err)
+	}
+
+	// Without a block duration the denial must not leave a block behind.
+	if blocked, _ := storage.IsBlocked(ctx, "ratelimit:{ip:192.0.2.1}:block"); blocked {
+		t.Fatalf("expected no block when BlockDuration is zero")
+	}
+}
+
+func TestRateLimiter_AlgorithmIsSelectedPerRule(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Requests:      1,
+			Window:        time.Minute,
+			BlockDuration: time.Minute,
+		},
+		TokenRules: map[string]domain.RateLimitRule{
+			"bucket": {Algorithm: domain.AlgorithmTokenBucket, RefillRate: 0.001, Burst: 2},
+		},
+	})
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "192.0.2.2", Token: "bucket"}); err != nil {
+			t.Fatalf("expected token bucket request %d to be allowed, got %v", i+1, err)
+		}
+	}
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "192.0.2.2", Token: "bucket"}); !domain.IsBlockedError(err) {
+		t.Fatalf("expected token bucket to deny, got %v", err)
+	}
+
+	// The IP rule keeps using its own fixed window.
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "192.0.2.2"}); err != nil {
+		t.Fatalf("expected IP request to be allowed, got %v", err)
+	}
+}
+
+func TestRateLimiter_SlidingStrategiesEnforceLimit(t *testing.T) {
+	for _, algorithm := range []domain.Algorithm{domain.AlgorithmSlidingLog, domain.AlgorithmSlidingWindow} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			service := newTestLimiter(t, newTestStorage(t), Config{
+				DefaultIPRule: domain.RateLimitRule{
+					Algorithm: algorithm,
+					Requests:  3,
+					Window:    time.Minute,
+				},
+			})
+
+			ctx := context.Background()
+
+			for i := 0; i < 3; i++ {
+				decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "192.0.2.3"})
+				if err != nil || !decision.Allowed {
+					t.Fatalf("expected request %d to be allowed, decision=%+v err=%v", i+1, decision, err)
+				}
+				if decision.CurrentCount != int64(i+1) {
+					t.Fatalf("expected count %d, got %d", i+1, decision.CurrentCount)
+				}
+			}
+
+			if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "192.0.2.3"}); !domain.IsBlockedError(err) {
+				t.Fatalf("expected fourth request to be denied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_GCRAReportsExactTimings(t *testing.T) {
+	clock := clocktest.New()
+	storage := memory.New(memory.Config{Clock: clock.Now})
+	t.Cleanup(func() { _ = storage.Close() })
+
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Algorithm: domain.AlgorithmGCRA,
+			Requests:  2,
+			Window:    time.Second,
+		},
+		Clock: clock.Now,
+	})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "192.0.2.4"}
+
+	for i, remaining := range []int64{1, 0} {
+		decision, err := service.Allow(ctx, req)
+		if err != nil || !decision.Allowed {
+			t.Fatalf("expected request %d to be allowed, decision=%+v err=%v", i+1, decision, err)
+		}
+		if decision.Remaining != remaining {
+			t.Fatalf("expected %d remaining after request %d, got %d", remaining, i+1, decision.Remaining)
+		}
+	}
+
+	decision, err := service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) {
+		t.Fatalf("expected third request to be denied, got %v", err)
+	}
+	if decision.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected retry after 500ms, got %v", decision.RetryAfter)
+	}
+	if decision.ResetAfter != time.Second {
+		t.Fatalf("expected reset after 1s, got %v", decision.ResetAfter)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+
+	if decision, err := service.Allow(ctx, req); err != nil || !decision.Allowed {
+		t.Fatalf("expected request to be allowed after retry interval, decision=%+v err=%v", decision, err)
+	}
+}
+
+func TestRateLimiter_ReportsTrippedTier(t *testing.T) {
+	storage := newTestStorage(t)
+	hourly := domain.Tier{Requests: 3, Window: time.Hour}
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Requests: 2,
+			Window:   time.Minute,
+			Tiers:    []domain.Tier{hourly},
+		},
+	})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "10.0.0.1"}
+
+	decision, err := service.Allow(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decision.Tier != (domain.Tier{Requests: 2, Window: time.Minute}) || decision.Remaining != 1 {
+		t.Fatalf("expected per-minute tier to be closest to exhaustion, got %+v", decision)
+	}
+
+	if _, err := service.Allow(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decision, err = service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) {
+		t.Fatalf("expected blocked error, got %v", err)
+	}
+	if decision.Tier.Window != time.Minute || decision.Limit != 2 || decision.RetryAfter <= 0 {
+		t.Fatalf("expected per-minute tier to trip, got %+v", decision)
+	}
+
+	// A rule can't mix tiers with algorithms that don't support them.
+	_, err = NewRateLimiterService(storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Algorithm: domain.AlgorithmSlidingLog,
+			Requests:  1,
+			Window:    time.Second,
+			Tiers:     []domain.Tier{hourly},
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected tiers on sliding log to be rejected")
+	}
+}
+
+func TestRateLimiter_CombinedModeRequiresEveryDimension(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule:    domain.RateLimitRule{Requests: 3, Window: time.Minute},
+		DefaultTokenRule: domain.RateLimitRule{Requests: 10, Window: time.Minute},
+		PairRule:         domain.RateLimitRule{Requests: 2, Window: time.Minute},
+		Combined:         true,
+	})
+
+	ctx := context.Background()
+
+	// The pair rule trips first for a single token and IP.
+	for i := 0; i < 2; i++ {
+		decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Token: "leaked"})
+		if err != nil {
+			t.Fatalf("unexpected error on request %d: %v", i+1, err)
+		}
+		if len(decision.Dimensions) != 3 {
+			t.Fatalf("expected ip, token and pair dimensions, got %+v", decision.Dimensions)
+		}
+	}
+	decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Token: "leaked"})
+	if !domain.IsBlockedError(err) || decision.IdentifierType != domain.IdentifierPair {
+		t.Fatalf("expected pair dimension to deny, got decision=%+v err=%v", decision, err)
+	}
+	if decision.Identifier != "leaked|10.0.0.1" {
+		t.Fatalf("unexpected pair identifier %q", decision.Identifier)
+	}
+
+	// Rotating tokens doesn't escape the IP limit.
+	decision, err = service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Token: "other"})
+	if !domain.IsBlockedError(err) || decision.IdentifierType != domain.IdentifierIP {
+		t.Fatalf("expected ip dimension to deny, got decision=%+v err=%v", decision, err)
+	}
+	if len(decision.Dimensions) != 1 {
+		t.Fatalf("expected evaluation to stop at the ip dimension, got %+v", decision.Dimensions)
+	}
+
+	// Requests without a token are limited by IP alone.
+	decision, err = service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.2"})
+	if err != nil || decision.IdentifierType != domain.IdentifierIP || decision.Dimensions != nil {
+		t.Fatalf("expected single ip decision, got decision=%+v err=%v", decision, err)
+	}
+}
+
+func TestRateLimiter_CombinedModeStopsChargingAfterDenial(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule:    domain.RateLimitRule{Requests: 10, Window: time.Minute},
+		DefaultTokenRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+		PairRule:         domain.RateLimitRule{Requests: 10, Window: time.Minute},
+		Combined:         true,
+	})
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "10.0.0.1", Token: "abc"}
+
+	if _, err := service.Allow(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decision, err := service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) || decision.IdentifierType != domain.IdentifierToken {
+		t.Fatalf("expected token dimension to deny, got decision=%+v err=%v", decision, err)
+	}
+
+	// The ip is evaluated before the token and was charged for both requests; the
+	// denied request consumed nothing from the token and never reached the pair.
+	for _, tc := range []struct {
+		identifierType domain.IdentifierType
+		identifier     string
+		want           int64
+	}{
+		{domain.IdentifierIP, "10.0.0.1", 2},
+		{domain.IdentifierToken, "abc", 1},
+		{domain.IdentifierPair, "abc|10.0.0.1", 1},
+	} {
+		state, err := service.Inspect(ctx, tc.identifierType, tc.identifier)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(state.Counters) != 1 || state.Counters[0].Count != tc.want {
+			t.Fatalf("expected %s counter %d, got %+v", tc.identifierType, tc.want, state.Counters)
+		}
+	}
+}
+
+func TestRateLimiter_GCRAQueuesRequestsWithinMaxDelay(t *testing.T) {
+	clock := clocktest.New()
+	storage := memory.New(memory.Config{Clock: clock.Now})
+	t.Cleanup(func() { _ = storage.Close() })
+
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Algorithm: domain.AlgorithmGCRA,
+			Requests:  2,
+			Window:    time.Second,
+			MaxDelay:  time.Second,
+		},
+		Clock: clock.Now,
+	})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "192.0.2.4"}
+
+	// The burst goes through at once; the next requests are spaced by the emission interval.
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		decision, err := service.Allow(ctx, req)
+		if err != nil || !decision.Allowed || decision.Delay != want {
+			t.Fatalf("request %d: expected delay %v, got %+v err=%v", i+1, want, decision, err)
+		}
+	}
+
+	decision, err := service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) || decision.Delay != 0 {
+		t.Fatalf("expected a wait beyond the max delay to be denied, got %+v err=%v", decision, err)
+	}
+	if decision.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected retry once the wait fits the max delay, got %v", decision.RetryAfter)
+	}
+}
+
+func TestRateLimiter_GCRARetryAfterDiscountsMaxDelay(t *testing.T) {
+	clock := clocktest.New()
+	storage := memory.New(memory.Config{Clock: clock.Now})
+	t.Cleanup(func() { _ = storage.Close() })
+
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{
+			Algorithm: domain.AlgorithmGCRA,
+			Requests:  2,
+			Window:    time.Second,
+			MaxDelay:  300 * time.Millisecond,
+		},
+		Clock: clock.Now,
+	})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "192.0.2.5"}
+	for i := 0; i < 2; i++ {
+		if decision, err := service.Allow(ctx, req); err != nil || decision.Delay != 0 {
+			t.Fatalf("request %d: expected the burst to pass without delay, got %+v err=%v", i+1, decision, err)
+		}
+	}
+
+	// The next slot opens in 500ms, 200ms beyond what the max delay allows.
+	decision, err := service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) || decision.RetryAfter != 200*time.Millisecond {
+		t.Fatalf("expected retry after 200ms, got %+v err=%v", decision, err)
+	}
+
+	clock.Advance(200 * time.Millisecond)
+	decision, err = service.Allow(ctx, req)
+	if err != nil || !decision.Allowed || decision.Delay != 300*time.Millisecond {
+		t.Fatalf("expected the retry to be queued for 300ms, got %+v err=%v", decision, err)
+	}
+}
+
+func TestRateLimiter_CalendarPeriodResetsOnBoundary(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	clock := clocktest.New()
+	// 2026-10-31 20:00 in São Paulo, four hours before the month turns there.
+	clock.Advance(time.Date(2026, 10, 31, 23, 0, 0, 0, time.UTC).Sub(clock.Now()))
+	storage := memory.New(memory.Config{Clock: clock.Now})
+	t.Cleanup(func() { _ = storage.Close() })
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 2, Period: domain.PeriodMonth, Location: saoPaulo},
+		Clock:         clock.Now,
+	})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "10.0.0.1"}
+	boundary := time.Date(2026, 11, 1, 0, 0, 0, 0, saoPaulo)
+
+	for i := 0; i < 2; i++ {
+		decision, err := service.Allow(ctx, req)
+		if err != nil || !decision.ResetAt.Equal(boundary) || decision.ResetAfter != 4*time.Hour {
+			t.Fatalf("request %d: expected reset at %v, got %+v err=%v", i+1, boundary, decision, err)
+		}
+	}
+	decision, err := service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) || decision.RetryAfter != 4*time.Hour || decision.Tier.Period != domain.PeriodMonth {
+		t.Fatalf("expected the monthly quota to deny until the boundary, got %+v err=%v", decision, err)
+	}
+
+	// Midnight UTC is still October in São Paulo.
+	clock.Advance(time.Hour + time.Minute)
+	if _, err := service.Allow(ctx, req); !domain.IsBlockedError(err) {
+		t.Fatalf("expected quota to hold until the local boundary, got %v", err)
+	}
+
+	clock.Advance(boundary.Sub(clock.Now()))
+	decision, err = service.Allow(ctx, req)
+	if err != nil || decision.Remaining != 1 || !decision.ResetAt.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, saoPaulo)) {
+		t.Fatalf("expected a fresh quota for November, got %+v err=%v", decision, err)
+	}
+}
+
+func TestTierCounter_AlignsToCalendar(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	// Wednesday, 2026-10-14 10:20:00 UTC.
+	now := time.Date(2026, 10, 14, 10, 20, 0, 0, time.UTC)
+
+	tests := []struct {
+		period domain.Period
+		loc    *time.Location
+		key    string
+		window time.Duration
+	}{
+		{domain.PeriodHour, time.UTC, "k:hour:2026-10-14T10", 40 * time.Minute},
+		{domain.PeriodHour, kolkata, "k:hour:2026-10-14T15", 10 * time.Minute},
+		{domain.PeriodDay, kolkata, "k:day:2026-10-14", 8*time.Hour + 10*time.Minute},
+		{domain.PeriodWeek, time.UTC, "k:week:2026-10-12", 4*24*time.Hour + 13*time.Hour + 40*time.Minute},
+		{domain.PeriodMonth, time.UTC, "k:month:2026-10", 17*24*time.Hour + 13*time.Hour + 40*time.Minute},
+	}
+	for _, tc := range tests {
+		counter := tierCounter("k", 0, domain.Tier{Requests: 1, Period: tc.period}, now, tc.loc)
+		if counter.Key != tc.key || counter.Window != tc.window {
+			t.Fatalf("%s in %s: expected %s for %v, got %s for %v", tc.period, tc.loc, tc.key, tc.window, counter.Key, counter.Window)
+		}
+	}
+}
+
+func TestRateLimiter_ShadowRulesReportWithoutDenying(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule:    domain.RateLimitRule{Requests: 1, Window: time.Minute, BlockDuration: time.Hour, Shadow: true},
+		DefaultTokenRule: domain.RateLimitRule{Requests: 2, Window: time.Minute},
+		Combined:         true,
+	})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "10.0.0.1", Token: "abc"}
+
+	if decision, err := service.Allow(ctx, req); err != nil || decision.Shadowed {
+		t.Fatalf("expected a plain allowed decision, got %+v err=%v", decision, err)
+	}
+
+	// The shadow ip rule would deny, but evaluation carries on to the enforced token rule.
+	decision, err := service.Allow(ctx, req)
+	if err != nil || !decision.Allowed || !decision.Shadowed {
+		t.Fatalf("expected shadowed decision, got %+v err=%v", decision, err)
+	}
+	if len(decision.Dimensions) != 2 || !decision.Dimensions[0].Shadowed || decision.Dimensions[1].Shadowed {
+		t.Fatalf("expected only the ip dimension to be shadowed, got %+v", decision.Dimensions)
+	}
+
+	// The block is still applied, so the ip rule keeps reporting while blocked.
+	blocked, err := storage.IsBlocked(ctx, buildKeys("", domain.IdentifierIP, "10.0.0.1").blockKey)
+	if err != nil || !blocked {
+		t.Fatalf("expected the shadow rule to block the ip, got blocked=%v err=%v", blocked, err)
+	}
+
+	decision, err = service.Allow(ctx, req)
+	if !domain.IsBlockedError(err) || decision.IdentifierType != domain.IdentifierToken || decision.Shadowed {
+		t.Fatalf("expected the enforced token rule to deny, got %+v err=%v", decision, err)
+	}
+}
+
+func TestRateLimiter_GlobalShadowNeverDenies(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Minute},
+		DenyList:      domain.AccessList{Tokens: []string{"evil"}},
+		Shadow:        true,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1"})
+		if err != nil || !decision.Allowed || decision.Shadowed != (i > 0) {
+			t.Fatalf("request %d: unexpected decision %+v err=%v", i+1, decision, err)
+		}
+	}
+
+	// The deny list is still enforced.
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.2", Token: "evil"}); !domain.IsDeniedError(err) {
+		t.Fatalf("expected deny list to apply in shadow mode, got %v", err)
+	}
+}
+
+func TestRateLimiter_CostConsumesQuota(t *testing.T) {
+	algorithms := []domain.RateLimitRule{
+		{Requests: 10, Window: time.Minute},
+		{Algorithm: domain.AlgorithmTokenBucket, RefillRate: 0.01, Burst: 10},
+		{Algorithm: domain.AlgorithmSlidingLog, Requests: 10, Window: time.Minute},
+		{Algorithm: domain.AlgorithmSlidingWindow, Requests: 10, Window: time.Minute},
+		{Algorithm: domain.AlgorithmGCRA, RefillRate: 0.01, Burst: 10},
+	}
+
+	for _, rule := range algorithms {
+		t.Run(string(rule.Algorithm), func(t *testing.T) {
+			storage := newTestStorage(t)
+			service := newTestLimiter(t, storage, Config{
+				DefaultIPRule: rule,
+				RouteRules:    []domain.RouteRule{{Method: "POST", Pattern: "/bulk", Cost: 4}},
+			})
+			ctx := context.Background()
+
+			decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Cost: 3})
+			if err != nil || decision.Remaining != 7 {
+				t.Fatalf("expected explicit cost to consume 3 units, got decision=%+v err=%v", decision, err)
+			}
+
+			bulk := domain.RateLimitRequest{IP: "10.0.0.1", Method: "POST", Route: "/bulk"}
+			decision, err = service.Allow(ctx, bulk)
+			if err != nil || decision.Remaining != 3 {
+				t.Fatalf("expected route cost to consume 4 units, got decision=%+v err=%v", decision, err)
+			}
+
+			// 3 units left: a request costing 4 must be denied without consuming them.
+			if _, err := service.Allow(ctx, bulk); !domain.IsBlockedError(err) {
+				t.Fatalf("expected request above the remaining quota to be denied, got %v", err)
+			}
+			decision, err = service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Cost: 3})
+			if err != nil || decision.Remaining != 0 {
+				t.Fatalf("expected remaining units to be available, got decision=%+v err=%v", decision, err)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_RouteRulesUseOwnQuota(t *testing.T) {
+	storage := newTestStorage(t)
+	service := newTestLimiter(t, storage, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 3, Window: time.Minute},
+		RouteRules: []domain.RouteRule{
+			{Method: "post", Pattern: "/export", Rule: domain.RateLimitRule{Requests: 1, Window: time.Minute}},
+			{Pattern: "/reports/{id}", Rule: domain.RateLimitRule{Requests: 2, Window: time.Minute}},
+		},
+	})
+
+	ctx := context.Background()
+	export := domain.RateLimitRequest{IP: "10.0.0.1", Method: "POST", Route: "/export"}
+
+	if _, err := service.Allow(ctx, export); err != nil {
+		t.Fatalf("unexpected error on first export: %v", err)
+	}
+	if _, err := service.Allow(ctx, export); !domain.IsBlockedError(err) {
+		t.Fatalf("expected export to be limited by its route rule, got %v", err)
+	}
+
+	// Other methods and unmatched routes fall back to the global rule and counters.
+	for _, req := range []domain.RateLimitRequest{
+		{IP: "10.0.0.1", Method: "GET", Route: "/export"},
+		{IP: "10.0.0.1", Method: "GET", Route: "/test"},
+		{IP: "10.0.0.1"},
+	} {
+		decision, err := service.Allow(ctx, req)
+		if err != nil {
+			t.Fatalf("expected %s %s to use the global quota, got %v", req.Method, req.Route, err)
+		}
+		if decision.Limit != 3 {
+			t.Fatalf("expected global limit 3 for %s %s, got %d", req.Method, req.Route, decision.Limit)
+		}
+	}
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1"}); !domain.IsBlockedError(err) {
+		t.Fatalf("expected global quota to be exhausted, got %v", err)
+	}
+
+	// A rule without method applies to every method of the route.
+	for _, method := range []string{"GET", "DELETE"} {
+		decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Method: method, Route: "/reports/{id}"})
+		if err != nil {
+			t.Fatalf("unexpected error on %s /reports/{id}: %v", method, err)
+		}
+		if decision.Limit != 2 {
+			t.Fatalf("expected route limit 2, got %d", decision.Limit)
+		}
+	}
+}
+
+func TestRateLimiter_RejectsInvalidRequests(t *testing.T) {
+	service := newTestLimiter(t, newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Second},
+	})
+
+	for name, req := range map[string]domain.RateLimitRequest{
+		"token without rule or ip": {Token: "unknown"},
+		"negative cost":            {IP: "10.0.0.1", Cost: -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := service.Allow(context.Background(), req); !errors.Is(err, domain.ErrInvalidRequest) {
+				t.Fatalf("expected ErrInvalidRequest, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_RejectsCostAboveRuleCapacity(t *testing.T) {
+	tests := map[string]struct {
+		rule     domain.RateLimitRule
+		capacity int64
+	}{
+		"fixed window tiers": {
+			rule:     domain.RateLimitRule{Requests: 10, Window: time.Second, Tiers: []domain.Tier{{Requests: 4, Window: time.Hour}}},
+			capacity: 4,
+		},
+		"token bucket": {
+			rule:     domain.RateLimitRule{Algorithm: domain.AlgorithmTokenBucket, Requests: 10, Window: time.Second, Burst: 3},
+			capacity: 3,
+		},
+		"sliding log": {
+			rule:     domain.RateLimitRule{Algorithm: domain.AlgorithmSlidingLog, Requests: 5, Window: time.Second},
+			capacity: 5,
+		},
+		"sliding window": {
+			rule:     domain.RateLimitRule{Algorithm: domain.AlgorithmSlidingWindow, Requests: 6, Window: time.Second},
+			capacity: 6,
+		},
+		"gcra with max delay": {
+			rule:     domain.RateLimitRule{Algorithm: domain.AlgorithmGCRA, Requests: 2, Window: time.Second, MaxDelay: time.Second},
+			capacity: 4,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.rule.BlockDuration = time.Minute
+			service := newTestLimiter(t, newTestStorage(t), Config{DefaultIPRule: tc.rule})
+			ctx := context.Background()
+
+			if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Cost: tc.capacity + 1}); !errors.Is(err, domain.ErrInvalidRequest) {
+				t.Fatalf("expected ErrInvalidRequest, got %v", err)
+			}
+			// The rejected request neither charged nor blocked the client.
+			decision, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1", Cost: tc.capacity})
+			if err != nil || !decision.Allowed {
+				t.Fatalf("expected a cost equal to the capacity to pass, got %+v err=%v", decision, err)
+			}
+		})
+	}
+}
+
+func TestNewRateLimiterService_RejectsInvalidRules(t *testing.T) {
+	storage := newTestStorage(t)
+
+	_, err := NewRateLimiterService(storage, Config{
+		DefaultIPRule: domain.RateLimitRule{Algorithm: domain.AlgorithmTokenBucket},
+	})
+	if err == nil {
+		t.Fatalf("expected token bucket without rate and burst to be rejected")
+	}
+
+	_, err = NewRateLimiterService(storage, Config{
+		DefaultIPRule: domain.RateLimitRule{Algorithm: "unknown", Requests: 1, Window: time.Second},
+	})
+	if err == nil {
+		t.Fatalf("expected unknown algorithm to be rejected")
+	}
+
+	valid := domain.RateLimitRule{Requests: 1, Window: time.Second}
+	_, err = NewRateLimiterService(storage, Config{
+		DefaultIPRule: valid,
+		RouteRules: []domain.RouteRule{
+			{Method: "GET", Pattern: "/x", Rule: valid},
+			{Method: "get", Pattern: "/x", Rule: valid},
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected duplicate route rules to be rejected")
+	}
+}
+
+func TestRateLimiter_UpdateConfigSwapsRules(t *testing.T) {
+	storage := newTestStorage(t)
+	rule := domain.RateLimitRule{Requests: 1, Window: time.Minute}
+	service := newTestLimiter(t, storage, Config{DefaultIPRule: rule})
+
+	ctx := context.Background()
+	req := domain.RateLimitRequest{IP: "10.0.0.1"}
+
+	if _, err := service.Allow(ctx, req); err != nil {
+		t.Fatalf("unexpected error on first request: %v", err)
+	}
+	if _, err := service.Allow(ctx, req); !domain.IsBlockedError(err) {
+		t.Fatalf("expected blocked error before reload, got %v", err)
+	}
+
+	if err := service.UpdateConfig(Config{DefaultIPRule: domain.RateLimitRule{Algorithm: "unknown"}}); err == nil {
+		t.Fatalf("expected invalid config to be rejected")
+	}
+	if _, err := service.Allow(ctx, req); !domain.IsBlockedError(err) {
+		t.Fatalf("expected rejected config to keep the current rules, got %v", err)
+	}
+
+	rule.Requests = 5
+	if err := service.UpdateConfig(Config{DefaultIPRule: rule}); err != nil {
+		t.Fatalf("unexpected error updating config: %v", err)
+	}
+	decision, err := service.Allow(ctx, req)
+	if err != nil {
+		t.Fatalf("expected request to be allowed after reload, got %v", err)
+	}
+	if decision.Limit != 5 {
+		t.Fatalf("expected reloaded limit 5, got %d", decision.Limit)
+	}
+}
+
+func TestRateLimiter_FailurePolicy(t *testing.T) {
+	tests := []struct {
+		policy  domain.FailurePolicy
+		allowed bool
+	}{
+		{policy: "", allowed: false},
+		{policy: domain.FailClosed, allowed: false},
+		{policy: domain.FailOpen, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			service := newTestLimiter(t, unavailableStorage{}, Config{
+				DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Second},
+				FailurePolicy: tt.policy,
+			})
+
+			decision, err := service.Allow(context.Background(), domain.RateLimitRequest{IP: "10.0.0.1"})
+			if decision.Allowed != tt.allowed || decision.Reason != domain.ReasonStorageUnavailable {
+				t.Fatalf("unexpected decision: %+v", decision)
+			}
+			if tt.allowed && err != nil {
+				t.Fatalf("expected fail-open to hide the error, got %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, domain.ErrUnavailable) {
+				t.Fatalf("expected ErrUnavailable, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_FailOpenLogsFailuresAtMostOncePerInterval(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	clock := clocktest.New()
+	service := newTestLimiter(t, unavailableStorage{}, Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Second},
+		FailurePolicy: domain.FailOpen,
+		Clock:         clock.Now,
+	})
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.1"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := strings.Count(logs.String(), "storage failed"); got != 1 {
+		t.Fatalf("expected a single log during the interval, got %d:\n%s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "ip 10.0.0.1") || !strings.Contains(logs.String(), ports.ErrStorageUnavailable.Error()) {
+		t.Fatalf("expected the log to name the dimension and the error, got %q", logs.String())
+	}
+
+	clock.Advance(failureLogInterval)
+	if _, err := service.Allow(ctx, domain.RateLimitRequest{IP: "10.0.0.2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Count(logs.String(), "storage failed"); got != 2 {
+		t.Fatalf("expected a new log after the interval, got %d:\n%s", got, logs.String())
+	}
+}
+
+func TestRateLimiter_RejectsUnknownFailurePolicy(t *testing.T) {
+	_, err := NewRateLimiterService(newTestStorage(t), Config{
+		DefaultIPRule: domain.RateLimitRule{Requests: 1, Window: time.Second},
+		FailurePolicy: "maybe",
+	})
+	if err == nil {
+		t.Fatalf("expected error for unknown failure policy")
+	}
+}
+
+func TestRateLimiter_FailureReportsFailingDimension(t *testing.T) {
+	service := newTestLimiter(t, tokenFailingStorage{newTestStorage(t)}, Config{
+		DefaultIPRule:    domain.RateLimitRule{Requests: 5, Window: time.Minute},
+		DefaultTokenRule: domain.RateLimitRule{Requests: 5, Window: time.Minute},
+		Combined:         true,
+		FailurePolicy:    domain.FailClosed,
+	})
+
+	decision, err := service.Allow(context.Background(), domain.RateLimitRequest{IP: "10.0.0.1", Token: "abc"})
+	if !errors.Is(err, domain.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if decision.IdentifierType != domain.IdentifierToken || decision.Identifier != "abc" {
+		t.Fatalf("expected the token dimension to be reported, got %+v", decision)
+	}
+}
+
+func TestBuildKeys_SharesHashTagAcrossNamespaces(t *testing.T) {
+	global := buildKeys("", domain.IdentifierIP, "10.0.0.1")
+	route := buildKeys(newRouteKey("GET", "/users/{id}").namespace(), domain.IdentifierIP, "10.0.0.1")
+
+	for _, key := range []string{global.counterKey, global.blockKey, route.counterKey, route.blockKey} {
+		if tag := hashTag(key); tag != "ip:10.0.0.1" {
+			t.Fatalf("expected hash tag ip:10.0.0.1 in %q, got %q", key, tag)
+		}
+	}
+}
+
+// newTestStorage returns an in-memory storage that is closed when the test ends.
+func newTestStorage(t *testing.T) *memory.Storage {
+	t.Helper()
+	storage := memory.New(memory.Config{})
+	t.Cleanup(func() { _ = storage.Close() })
+	return storage
+}
+
 // newTestLimiter is a helper that fails the test immediately if creation fails.
-func newTestLimiter(t *testing.T, storage *mockStorage, cfg Config) *RateLimiterService {
+func newTestLimiter(t *testing.T, storage ports.Storage, cfg Config) *RateLimiterService {
 	t.Helper()
 	service, err := NewRateLimiterService(storage, cfg)
 	if err != nil {
@@ -144,40 +1071,40 @@ func newTestLimiter(t *testing.T, storage *mockStorage, cfg Config) *RateLimiter
 	return service
 }
 
-type mockStorage struct {
-	counts map[string]int64
-	blocks map[string]time.Time
+// tokenFailingStorage fails only for token keys, leaving the IP dimension healthy.
+type tokenFailingStorage struct {
+	ports.Storage
 }
 
-func newMockStorage() *mockStorage {
-	return &mockStorage{
-		counts: make(map[string]int64),
-		blocks: make(map[string]time.Time),
+func (s tokenFailingStorage) Hit(ctx context.Context, blockKey string, counters []ports.Counter, block time.Duration, cost int64) (ports.HitResult, error) {
+	if strings.Contains(blockKey, "{token:") {
+		return ports.HitResult{}, ports.ErrStorageUnavailable
 	}
+	return s.Storage.Hit(ctx, blockKey, counters, block, cost)
 }
 
-func (m *mockStorage) Increment(_ context.Context, key string, _ time.Duration) (int64, error) {
-	m.counts[key]++
-	return m.counts[key], nil
+// unavailableStorage behaves like a storage behind an open circuit breaker.
+type unavailableStorage struct {
+	ports.Storage
 }
 
-func (m *mockStorage) IsBlocked(_ context.Context, key string) (bool, error) {
-	expiration, ok := m.blocks[key]
-	if !ok {
-		return false, nil
-	}
-	if time.Now().After(expiration) {
-		delete(m.blocks, key)
-		return false, nil
-	}
-	return true, nil
+func (unavailableStorage) Hit(context.Context, string, []ports.Counter, time.Duration, int64) (ports.HitResult, error) {
+	return ports.HitResult{}, ports.ErrStorageUnavailable
 }
 
-func (m *mockStorage) SetBlock(_ context.Context, key string, duration time.Duration) error {
-	if duration <= 0 {
-		delete(m.blocks, key)
-		return nil
+func (unavailableStorage) AcquireSlot(context.Context, string, string, int, time.Duration) (ports.SlotResult, error) {
+	return ports.SlotResult{}, ports.ErrStorageUnavailable
+}
+
+// hashTag extracts the part of the key Redis Cluster hashes.
+func hashTag(key string) string {
+	start := strings.Index(key, "{")
+	if start < 0 {
+		return key
+	}
+	end := strings.Index(key[start+1:], "}")
+	if end <= 0 {
+		return key
 	}
-	m.blocks[key] = time.Now().Add(duration)
-	return nil
+	return key[start+1 : start+1+end]
 }
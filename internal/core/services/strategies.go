@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/JeanGrijp/rate-limiter/internal/core/domain"
+	"github.com/JeanGrijp/rate-limiter/internal/core/ports"
+)
+
+// strategy encapsula um algoritmo de limitação. Cada estratégia deriva a própria
+// chave a partir da chave base do identificador para que algoritmos diferentes
+// nunca disputem a mesma estrutura no storage, e é responsável por respeitar e
+// aplicar o bloqueio da regra. cost é quanto da cota a requisição consome.
+type strategy interface {
+	take(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule, now time.Time, cost int64) (outcome, error)
+}
+
+// outcome é o resultado de uma estratégia, independente do algoritmo.
+type outcome struct {
+	allowed    bool
+	count      int64
+	remaining  int64
+	retryAfter time.Duration
+	resetAfter time.Duration
+	// tier é preenchido pela janela fixa; nas demais estratégias o limite vem da regra.
+	tier domain.Tier
+	// penaltyLevel é o nível de escalonamento do bloqueio, em regras com escalonamento.
+	penaltyLevel int
+	// delay é a espera exigida de uma requisição permitida, em regras com MaxDelay.
+	delay time.Duration
+}
+
+func (o outcome) decision(allowed bool, keys resolvedKeys, rule domain.RateLimitRule) domain.Decision {
+	limit := rule.Limit()
+	if o.tier.Requests > 0 {
+		limit = int64(o.tier.Requests)
+	}
+	return domain.Decision{
+		Allowed:        allowed,
+		Identifier:     keys.identifier,
+		IdentifierType: keys.identifierType,
+		AppliedRule:    rule,
+		CurrentCount:   o.count,
+		Limit:          limit,
+		Remaining:      o.remaining,
+		RetryAfter:     o.retryAfter,
+		ResetAfter:     o.resetAfter,
+		Tier:           o.tier,
+		Reason:         domain.ReasonLimit,
+		PenaltyLevel:   o.penaltyLevel,
+		Delay:          o.delay,
+	}
+}
+
+// strategies associa cada algoritmo à sua implementação. A regra sem algoritmo
+// explícito usa janela fixa, preservando o comportamento original.
+var strategies = map[domain.Algorithm]strategy{
+	"":                            fixedWindowStrategy{},
+	domain.AlgorithmFixedWindow:   fixedWindowStrategy{},
+	domain.AlgorithmTokenBucket:   blockGuard{tokenBucketStrategy{}},
+	domain.AlgorithmSlidingLog:    blockGuard{slidingLogStrategy{}},
+	domain.AlgorithmSlidingWindow: blockGuard{slidingWindowStrategy{}},
+	domain.AlgorithmGCRA:          blockGuard{gcraStrategy{}},
+}
+
+// blockGuard adiciona o bloqueio a estratégias que não o tratam atomicamente:
+// consulta o bloqueio antes de consumir e o aplica depois de uma negação, em
+// chamadas separadas ao storage. Requisições simultâneas podem passar pela consulta
+// antes de o bloqueio ser gravado; elas continuam sujeitas ao limite da estratégia,
+// mas, com escalonamento, cada negação concorrente conta como uma violação.
+type blockGuard struct {
+	strategy
+}
+
+func (g blockGuard) take(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule, now time.Time, cost int64) (outcome, error) {
+	blockTTL, err := storage.TTL(ctx, keys.blockKey)
+	if err != nil {
+		return outcome{}, err
+	}
+	if blockTTL != 0 {
+		level, err := penaltyLevel(ctx, storage, keys, rule)
+		if err != nil {
+			return outcome{}, err
+		}
+		return outcome{allowed: false, retryAfter: max(blockTTL, 0), penaltyLevel: level}, nil
+	}
+
+	result, err := g.strategy.take(ctx, storage, keys, rule, now, cost)
+	if err != nil || result.allowed {
+		return result, err
+	}
+
+	block, level, err := penalize(ctx, storage, keys, rule)
+	if err != nil {
+		return outcome{}, err
+	}
+	result.retryAfter = max(result.retryAfter, block)
+	result.penaltyLevel = level
+	return result, nil
+}
+
+// fixedWindowStrategy usa o Hit do storage, que verifica o bloqueio, avalia todos os
+// tiers da regra e bloqueia em uma única operação atômica. Com escalonamento, a duração
+// depende do histórico de violações, então o Hit não bloqueia e o bloqueio é aplicado
+// em seguida, como no blockGuard.
+type fixedWindowStrategy struct{}
+
+func (fixedWindowStrategy) take(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule, now time.Time, cost int64) (outcome, error) {
+	tiers := rule.Limits()
+	counters := make([]ports.Counter, len(tiers))
+	for i, tier := range tiers {
+		counters[i] = tierCounter(keys.counterKey, i, tier, now, rule.TimeZone())
+	}
+
+	block := rule.BlockDuration
+	if len(rule.Escalation) > 0 {
+		block = 0
+	}
+	result, err := storage.Hit(ctx, keys.blockKey, counters, block, cost)
+	if err != nil {
+		return outcome{}, err
+	}
+	if len(result.Counts) != len(tiers) || len(result.TTLs) != len(tiers) {
+		return outcome{}, fmt.Errorf("storage returned %d counters for %d tiers", len(result.Counts), len(tiers))
+	}
+
+	// O tier reportado é o que negou a requisição ou, na falta dele, o de menor sobra.
+	index := result.Exceeded
+	if index < 0 {
+		index = 0
+		for i, tier := range tiers {
+			if int64(tier.Requests)-result.Counts[i] < int64(tiers[index].Requests)-result.Counts[index] {
+				index = i
+			}
+		}
+	}
+
+	tier := tiers[index]
+	o := outcome{
+		allowed:    !result.Blocked && result.Exceeded < 0,
+		count:      result.Counts[index],
+		remaining:  max(int64(tier.Requests)-result.Counts[index], 0),
+		resetAfter: result.TTLs[index],
+		tier:       tier,
+	}
+	if tier.Period != "" {
+		// A virada do período é conhecida com exatidão, sem depender do TTL.
+		o.resetAfter = counters[index].Window
+	}
+	switch {
+	case result.Blocked:
+		o.retryAfter = result.BlockTTL
+	case !o.allowed:
+		o.retryAfter = o.resetAfter
+	}
+	if len(rule.Escalation) == 0 || o.allowed {
+		return o, nil
+	}
+
+	// Sem violação nova, o identificador já estava bloqueado.
+	if result.Exceeded < 0 {
+		if o.penaltyLevel, err = penaltyLevel(ctx, storage, keys, rule); err != nil {
+			return outcome{}, err
+		}
+		return o, nil
+	}
+	block, o.penaltyLevel, err = penalize(ctx, storage, keys, rule)
+	if err != nil {
+		return outcome{}, err
+	}
+	o.retryAfter = max(o.retryAfter, block)
+	return o, nil
+}
+
+// periodLayouts formatam o início do período na chave dos contadores de calendário.
+var periodLayouts = map[domain.Period]string{
+	domain.PeriodHour:  "2006-01-02T15",
+	domain.PeriodDay:   "2006-01-02",
+	domain.PeriodWeek:  "2006-01-02",
+	domain.PeriodMonth: "2006-01",
+}
+
+// tierCounter monta o contador de um tier. Em períodos de calendário a chave inclui o
+// início do período no fuso da regra, então o contador recomeça exatamente na virada,
+// e a janela é o tempo que falta até ela.
+func tierCounter(counterKey string, index int, tier domain.Tier, now time.Time, loc *time.Location) ports.Counter {
+	if tier.Period == "" {
+		return ports.Counter{Key: tierKey(counterKey, index, tier), Window: tier.Window, Limit: tier.Requests}
+	}
+	start, end := tier.Period.Bounds(now.In(loc))
+	return ports.Counter{
+		Key:    counterKey + ":" + string(tier.Period) + ":" + start.Format(periodLayouts[tier.Period]),
+		Window: max(end.Sub(now), time.Millisecond),
+		Limit:  tier.Requests,
+	}
+}
+
+// tierKey mantém a chave original para o limite principal e deriva as dos tiers
+// adicionais da janela, para que reordenar os tiers não reinicie os contadores.
+func tierKey(counterKey string, index int, tier domain.Tier) string {
+	if index == 0 {
+		return counterKey
+	}
+	return counterKey + ":" + tier.Window.String()
+}
+
+type tokenBucketStrategy struct{}
+
+func (tokenBucketStrategy) take(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule, _ time.Time, cost int64) (outcome, error) {
+	rate, burst := rule.RateAndBurst()
+	result, err := storage.TakeToken(ctx, keys.counterKey+":bucket", rate, burst, cost)
+	if err != nil {
+		return outcome{}, err
+	}
+	return outcome{
+		allowed:    result.Allowed,
+		remaining:  int64(math.Floor(result.Tokens)),
+		retryAfter: result.RetryAfter,
+		resetAfter: time.Duration(math.Ceil((float64(burst) - result.Tokens) / rate * float64(time.Second))),
+	}, nil
+}
+
+type slidingLogStrategy struct{}
+
+func (slidingLogStrategy) take(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule, _ time.Time, cost int64) (outcome, error) {
+	result, err := storage.TakeSlidingLog(ctx, keys.counterKey+":log", rule.Window, rule.Requests, cost)
+	if err != nil {
+		return outcome{}, err
+	}
+	return slidingOutcome(result, rule), nil
+}
+
+type slidingWindowStrategy struct{}
+
+func (slidingWindowStrategy) take(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule, _ time.Time, cost int64) (outcome, error) {
+	result, err := storage.TakeSlidingWindow(ctx, keys.counterKey+":sliding", rule.Window, rule.Requests, cost)
+	if err != nil {
+		return outcome{}, err
+	}
+	return slidingOutcome(result, rule), nil
+}
+
+func slidingOutcome(result ports.SlidingWindowResult, rule domain.RateLimitRule) outcome {
+	return outcome{
+		allowed:    result.Allowed,
+		count:      result.Count,
+		remaining:  max(int64(rule.Requests)-result.Count, 0),
+		retryAfter: result.RetryAfter,
+		resetAfter: result.ResetAfter,
+	}
+}
+
+// gcraMaxAttempts limita as tentativas de compare-and-swap sob contenção na mesma chave.
+const gcraMaxAttempts = 10
+
+var errGCRAContention = errors.New("gcra: too many concurrent updates")
+
+// gcraStrategy implementa o generic cell rate algorithm. O storage guarda apenas o
+// "theoretical arrival time" (TAT) em nanossegundos e a atualização é feita com
+// compare-and-swap, repetindo a leitura quando outra instância altera a chave. Com
+// MaxDelay, uma requisição que só caberia no futuro avança o TAT mesmo assim e recebe
+// a espera até a vez dela, formando uma fila. O TAT é calculado com o relógio da
+// instância (Config.Clock), e não com o do storage: uma instância adiantada consome a
+// vez das demais e uma atrasada espera a mais, por isso os relógios devem estar
+// sincronizados.
+type gcraStrategy struct{}
+
+func (gcraStrategy) take(ctx context.Context, storage ports.Storage, keys resolvedKeys, rule domain.RateLimitRule, now time.Time, cost int64) (outcome, error) {
+	rate, burst := rule.RateAndBurst()
+	emission := time.Duration(float64(time.Second) / rate)
+	tolerance := emission * time.Duration(burst)
+	key := keys.counterKey + ":gcra"
+
+	for attempt := 0; attempt < gcraMaxAttempts; attempt++ {
+		stored, err := storage.Get(ctx, key)
+		if err != nil {
+			return outcome{}, err
+		}
+
+		tat := now
+		if stored != 0 {
+			if storedTAT := time.Unix(0, stored); storedTAT.After(now) {
+				tat = storedTAT
+			}
+		}
+
+		newTAT := tat.Add(emission * time.Duration(cost))
+		allowAt := newTAT.Add(-tolerance)
+		wait := allowAt.Sub(now)
+		if wait > rule.MaxDelay {
+			return outcome{
+				allowed:    false,
+				retryAfter: wait - rule.MaxDelay,
+				resetAfter: tat.Sub(now),
+			}, nil
+		}
+
+		swapped, err := storage.CompareAndSwap(ctx, key, stored, newTAT.UnixNano(), newTAT.Sub(now))
+		if err != nil {
+			return outcome{}, err
+		}
+		if swapped {
+			return outcome{
+				allowed:    true,
+				remaining:  max(int64(now.Sub(allowAt)/emission), 0),
+				resetAfter: newTAT.Sub(now),
+				delay:      max(wait, 0),
+			}, nil
+		}
+	}
+
+	return outcome{}, errGCRAContention
+}